@@ -0,0 +1,143 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Alias takes a name and returns the input which the alias by that name
+// expands to and whether it exists.
+func (app *App) Alias(name string) (string, bool) {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	value, ok := app.aliases[name]
+	return value, ok
+}
+
+// Aliases returns a copy of all aliases, mapping the name of each to the input
+// which it expands to.
+func (app *App) Aliases() map[string]string {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	aliases := make(map[string]string, len(app.aliases))
+	for name, value := range app.aliases {
+		aliases[name] = value
+	}
+
+	return aliases
+}
+
+// AddAlias takes a name and some input and adds an alias, replacing any which
+// already exists by that name. When the name is found unquoted as the first
+// word of a command it is replaced by the input before the command is
+// matched. An error is returned if the name is invalid or is already the name
+// of a command, if the input is blank or contains anything other than words
+// and redirections, or if the alias would expand to itself.
+func (app *App) AddAlias(name, value string) error {
+	if name == "" || strings.IndexFunc(name, unicode.IsSpace) != -1 || strings.ContainsAny(name, "|;&<>'\"\\$") {
+		return fmt.Errorf("App.AddAlias: invalid alias name '%s'", name)
+	}
+
+	if cmd, _ := findCommand(app.Commands, name, false); cmd != nil {
+		return fmt.Errorf("App.AddAlias: '%s' already exists as a command", name)
+	}
+
+	tokens, err := tokenize(value)
+	if err != nil {
+		return fmt.Errorf("App.AddAlias: failed to parse value of '%s':\n%s", name, err)
+	}
+
+	if len(tokens) == 0 {
+		return fmt.Errorf("App.AddAlias: value of '%s' cannot be blank", name)
+	}
+
+	for _, tok := range tokens {
+		if tok.kind != tokenWord && !tok.kind.isRedirect() {
+			return fmt.Errorf("App.AddAlias: value of '%s' must not contain the operator '%s'", name, tok.value)
+		}
+	}
+
+	if err := validateStage(value, tokens); err != nil {
+		return fmt.Errorf("App.AddAlias: failed to parse value of '%s':\n%s", name, err)
+	}
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	// follow the chain of aliases beginning with this one to detect recursion
+	seen := make(map[string]bool)
+	for next := tokens[0]; isPlainWord(next) && !seen[next.value]; {
+		if next.value == name {
+			return fmt.Errorf("App.AddAlias: '%s' is recursive", name)
+		}
+
+		nextValue, ok := app.aliases[next.value]
+		if !ok {
+			break
+		}
+
+		seen[next.value] = true
+		nextTokens, _ := tokenize(nextValue)
+		next = nextTokens[0]
+	}
+
+	if app.aliases == nil {
+		app.aliases = make(map[string]string)
+	}
+
+	app.aliases[name] = value
+	return nil
+}
+
+// RemoveAlias takes a name and removes the alias by that name. An error is
+// returned if no such alias exists.
+func (app *App) RemoveAlias(name string) error {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if _, ok := app.aliases[name]; !ok {
+		return fmt.Errorf("App.RemoveAlias: alias '%s' does not exist", name)
+	}
+
+	delete(app.aliases, name)
+	return nil
+}
+
+// isPlainWord returns true if the token is a word containing no quotes,
+// escapes, or variables, and so may be replaced by an alias.
+func isPlainWord(tok token) bool {
+	if tok.kind != tokenWord || strings.ContainsAny(tok.value, "$'\"\\") ||
+		!strings.HasPrefix(tok.input[tok.pos:], tok.value) {
+		return false
+	}
+
+	// the word must end immediately after its value
+	rest := tok.input[tok.pos+len(tok.value):]
+	return rest == "" || strings.IndexFunc(rest[:1], unicode.IsSpace) == 0 || strings.ContainsAny(rest[:1], "|;&<>")
+}
+
+// expandAlias takes the tokens of a single stage and, if the first is the name
+// of an alias, replaces it with the tokens of the alias value. This is
+// repeated for the new first token until it is not an alias or is an alias
+// which has already been expanded.
+func (app *App) expandAlias(tokens []token) []token {
+	expanded := make(map[string]bool)
+
+	for len(tokens) > 0 && isPlainWord(tokens[0]) && !expanded[tokens[0].value] {
+		value, ok := app.Alias(tokens[0].value)
+		if !ok {
+			break
+		}
+
+		expanded[tokens[0].value] = true
+
+		// alias values are validated when added and so always tokenize
+		aliasTokens, _ := tokenize(value)
+		tokens = append(aliasTokens, tokens[1:]...)
+	}
+
+	return tokens
+}
@@ -0,0 +1,126 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAddAlias ensures that valid aliases may be added and removed and that
+// the correct errors are returned with invalid aliases.
+func TestAddAlias(t *testing.T) {
+	WithPipeCommands(t, "TestAddAlias", func(app *App, _ *strings.Builder) {
+		expectError := func(name, value, msg, substr string) {
+			if err := app.AddAlias(name, value); err == nil {
+				t.Errorf("App.AddAlias: expected error with %s", msg)
+			} else if !strings.Contains(err.Error(), substr) {
+				t.Errorf("App.AddAlias: expected error message with %s to contain substring '%s' got:\n%s", msg,
+					substr, err)
+			}
+		}
+
+		if err := app.AddAlias("e", "emit hello"); err != nil {
+			t.Fatal("App.AddAlias: got error with valid alias:\n", err)
+		}
+
+		if res, ok := app.Alias("e"); !ok || res != "emit hello" {
+			t.Errorf("App.Alias: got '%s' expected 'emit hello'", res)
+		}
+
+		expectError("", "emit", "blank name", "invalid alias name")
+		expectError("a b", "emit", "whitespace in name", "invalid alias name")
+		expectError("a|b", "emit", "operator in name", "invalid alias name")
+		expectError("emit", "upper", "existing command name", "already exists as a command")
+		expectError("blank", " ", "blank value", "cannot be blank")
+		expectError("piped", "emit a | upper", "operator in value", "must not contain the operator '|'")
+		expectError("quote", "emit 'a", "unterminated quote in value", "unterminated single quote")
+		expectError("only", "> out.txt", "only a redirection in value", "missing command")
+		expectError("self", "self -x", "alias of itself", "is recursive")
+
+		if err := app.AddAlias("a", "b"); err != nil {
+			t.Error("App.AddAlias: got error with valid alias:\n", err)
+		}
+		if err := app.AddAlias("b", "c"); err != nil {
+			t.Error("App.AddAlias: got error with valid alias:\n", err)
+		}
+		expectError("c", "a", "indirectly recursive alias", "is recursive")
+
+		if err := app.AddCommand(Command{Name: "e", Main: blankMainFunc}); err == nil {
+			t.Error("App.AddCommand: expected error with name of existing alias")
+		} else if !strings.Contains(err.Error(), "already exists as an alias") {
+			t.Error("App.AddCommand: got unexpected error message with name of existing alias:\n", err)
+		}
+
+		if err := app.RemoveAlias("e"); err != nil {
+			t.Error("App.RemoveAlias: got error:\n", err)
+		} else if _, ok := app.Alias("e"); ok {
+			t.Error("App.RemoveAlias: expected alias to not exist after removal")
+		}
+
+		if err := app.RemoveAlias("e"); err == nil {
+			t.Error("App.RemoveAlias: expected error with non-existent alias")
+		}
+
+		if aliases := app.Aliases(); len(aliases) != 2 || aliases["a"] != "b" || aliases["b"] != "c" {
+			t.Errorf("App.Aliases: got %v expected 'a' and 'b'", aliases)
+		}
+	})
+}
+
+// TestAliasExpansion ensures that aliases are expanded before commands are
+// matched.
+func TestAliasExpansion(t *testing.T) {
+	WithPipeCommands(t, "TestAliasExpansion", func(app *App, output *strings.Builder) {
+		expect := func(input string, result string) {
+			output.Reset()
+			if _, err := app.ExecuteString(input); err != nil {
+				t.Errorf("App.ExecuteString: got error with input `%s`:\n%s", input, err)
+			} else if output.String() != result {
+				t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", output.String(), input,
+					result)
+			}
+		}
+
+		for name, value := range map[string]string{
+			"greet": "emit 'hello world'",
+			"shout": "greet $who",
+			"up":    "upper",
+		} {
+			if err := app.AddAlias(name, value); err != nil {
+				t.Fatal("App.AddAlias: got error:\n", err)
+			}
+		}
+
+		app.SetVariable("who", "you")
+
+		expect("greet", "hello world\n")
+		expect("greet again", "hello world\nagain\n")
+		expect("shout | up", "HELLO WORLD\nYOU\n")
+		expect("emit greet", "greet\n")
+		expect("greet&&greet", "hello world\nhello world\n")
+
+		if _, err := app.ExecuteString("'greet'"); err == nil {
+			t.Error("App.ExecuteString: expected quoted alias name to not be expanded")
+		} else if _, ok := err.(*ErrNoCmd); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrNoCmd with quoted alias name:\n", err)
+		}
+	})
+}
+
+// TestAliasCommands tests the default top-level alias and unalias commands as
+// well as help for aliases.
+func TestAliasCommands(t *testing.T) {
+	app := NewApp("TestAliasCommands", true)
+
+	MainInput(t, app, "alias with definitions", `alias ll="help exit" h=help`)
+	MainInput(t, app, "alias with no arguments", "alias", "h='help'\nll='help exit'\n")
+	MainInput(t, app, "alias with a name", "alias ll", "ll='help exit'")
+	MainInput(t, app, "alias with a non-existent name", "alias nothing", "nothing: alias not found")
+	MainInput(t, app, "alias over a command", "alias exit=help", "already exists as a command")
+	MainInput(t, app, "recursive alias", "alias h=ll; alias ll=h", "is recursive")
+	MainInput(t, app, "expanding alias", "ll", "exit [-shell-only]")
+	MainInput(t, app, "help with no arguments", "help", "Aliases:", "help exit")
+	MainInput(t, app, "help for alias", "help ll", "ll: alias for 'help exit'")
+	MainInput(t, app, "unalias with no arguments", "unalias", "unalias <name>")
+	MainInput(t, app, "unalias with a non-existent name", "unalias nothing", "nothing: alias not found")
+	MainInput(t, app, "unalias", "unalias ll; ll", "ll: command not found")
+}
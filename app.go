@@ -1,12 +1,16 @@
 package shell
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 
 	"github.com/chzyer/readline"
@@ -16,6 +20,10 @@ import (
 // command.
 type ErrNoCmd struct {
 	Name string
+
+	// Suggestions holds the names of any commands or sub-commands which Name
+	// is likely a misspelling of, ordered from closest to furthest.
+	Suggestions []string
 }
 
 // Error implements the error interface for ErrNoCmd.
@@ -23,17 +31,88 @@ func (err *ErrNoCmd) Error() string {
 	return fmt.Sprintf("App.ExecuteString: command '%s' not found", err.Name)
 }
 
-// ErrParseInput is returned from ExecuteString is the input for some reason
-// cannot be parsed. Currently occurs only when input is empty.
+// ErrAmbiguousCmd is returned from ExecuteString if the App allows
+// abbreviations and the input calls a command by a prefix which is shared by
+// several commands.
+type ErrAmbiguousCmd struct {
+	Name string
+
+	// Candidates holds the sorted names of all commands which Name may
+	// abbreviate.
+	Candidates []string
+}
+
+// Error implements the error interface for ErrAmbiguousCmd.
+func (err *ErrAmbiguousCmd) Error() string {
+	return fmt.Sprintf("App.ExecuteString: command '%s' is ambiguous, could be: %s", err.Name,
+		strings.Join(err.Candidates, ", "))
+}
+
+// ErrParseInput is returned from ExecuteString if the input for some reason
+// cannot be parsed, such as when it is empty or contains an unterminated quote.
 type ErrParseInput struct {
 	Input string
+
+	// Position is the zero-based byte offset within Input at which the problem
+	// was found.
+	Position int
+
+	// Reason is a short description of the problem.
+	Reason string
 }
 
 // Error implements the error interface for ErrParseInput
 func (err *ErrParseInput) Error() string {
-	return fmt.Sprintf("App.ExecuteString: failed to parse input '%s'", err.Input)
+	return fmt.Sprintf("App.ExecuteString: failed to parse input '%s' at position %d: %s", err.Input,
+		err.Position, err.Reason)
+}
+
+// ErrRedirect is returned from ExecuteString if a file named in a redirection
+// cannot be opened.
+type ErrRedirect struct {
+	// Op is the redirection operator, such as '>' or '<'.
+	Op string
+
+	// Path is the name of the file as provided in the input.
+	Path string
+
+	// Err is the error returned while opening the file.
+	Err error
+}
+
+// Error implements the error interface for ErrRedirect.
+func (err *ErrRedirect) Error() string {
+	return fmt.Sprintf("App.ExecuteString: failed to redirect '%s' to '%s':\n%s", err.Op, err.Path, err.Err)
+}
+
+// ErrSubstitution is returned from ExecuteString if the command within a
+// command substitution returns an error or an ExitStatus other than ExitCmd.
+type ErrSubstitution struct {
+	// Input is the input within the command substitution.
+	Input string
+
+	// Status is the ExitStatus returned by the command.
+	Status ExitStatus
+
+	// Err is the error returned by the command, if any.
+	Err error
 }
 
+// Error implements the error interface for ErrSubstitution.
+func (err *ErrSubstitution) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("App.ExecuteString: command substitution '%s' failed:\n%s", err.Input, err.Err)
+	}
+
+	return fmt.Sprintf("App.ExecuteString: command substitution '%s' returned ExitStatus %d", err.Input, err.Status)
+}
+
+// DefaultBanner is the Banner set by NewApp.
+const DefaultBanner = "Welcome to the shell. Type \"help\" for available Commands."
+
+// DefaultPrompt is the Prompt used by Main if none is set.
+const DefaultPrompt = "> "
+
 // App is the main structure that makes up a single shell. Through it commands
 // are created and managed. App is not intended to be directly created or
 // manipulated, instead its methods and NewApp should be utilized.
@@ -53,6 +132,100 @@ type App struct {
 
 	// Input controls the reader used to fetch user input.
 	Input io.ReadCloser
+
+	// Banner is printed to the App's Output when Main starts, unless blank.
+	// NewApp sets it to DefaultBanner.
+	Banner string
+
+	// Prompt is printed by Main before each line is read. It is evaluated
+	// anew each time, with App variables referenced as $NAME or ${NAME}
+	// replaced by their values and $? replaced by the exit code of the last
+	// line, as returned by ExitCode. Defaults to DefaultPrompt if blank.
+	Prompt string
+
+	// PromptFunc, if not nil, is called before each line is read and its
+	// result is used in place of Prompt.
+	PromptFunc func(*App) string
+
+	// AllowAbbreviations controls whether commands and sub-commands may be
+	// called by any prefix of their name or one of their aliases, so long as
+	// the prefix is shared with no other command at the same level.
+	AllowAbbreviations bool
+
+	// HistoryFile is the path of the file in which the history of the main
+	// loop is kept between sessions. If blank and HistoryStore is nil, history
+	// is kept only until the App exits.
+	HistoryFile string
+
+	// HistoryStore, if not nil, is used to keep history between sessions in
+	// place of HistoryFile.
+	HistoryStore HistoryStore
+
+	// HistorySize is the maximum number of history entries to be kept.
+	// Defaults to DefaultHistorySize if zero.
+	HistorySize int
+
+	// HistoryDedup controls whether earlier history entries identical to a new
+	// one are removed, such that no entry appears more than once.
+	HistoryDedup bool
+
+	// HistoryIgnoreSpace controls whether lines beginning with a space are
+	// left out of the history.
+	HistoryIgnoreSpace bool
+
+	// SetFlags may register flags in the same manner as Command.SetFlags
+	// which are accepted by every command and sub-command, such as -json or
+	// -debug. Their values are accessible via the Context of each command.
+	// Flags registered by a command may not share the name of one of these:
+	// AddCommand returns an error if one does while SetFlags is set, and
+	// otherwise, such as for the default commands added by NewApp, the command
+	// returns an error when executed.
+	SetFlags func(*Context)
+
+	// GNUFlags controls whether the flags of every command are parsed in the
+	// GNU style, as described by Command.GNUFlags.
+	GNUFlags bool
+
+	// Timeout is the default duration after which the context.Context of a
+	// command is cancelled, used for any command with a Timeout of zero. If
+	// zero or negative, commands have no timeout by default.
+	Timeout time.Duration
+
+	// ExitOnDoubleInterrupt controls whether pressing Ctrl-C twice in a row at
+	// an empty prompt exits Main. Otherwise, Ctrl-C only clears the line and
+	// Main exits on Ctrl-D.
+	ExitOnDoubleInterrupt bool
+
+	// StopOnError controls whether ExecuteScript and the default source
+	// command stop at the first line of a script which returns an error.
+	StopOnError bool
+
+	// variables holds all App variables, which are expanded within user input
+	// and may be managed through the App or a Context.
+	variables map[string]string
+
+	// aliases maps the name of each alias to the input it expands to.
+	aliases map[string]string
+
+	// history holds all history entries from oldest to newest.
+	history []string
+
+	// interrupt cancels the context.Context of the commands currently being
+	// run by Main, if any.
+	interrupt context.CancelFunc
+
+	// lastStatus and lastErr hold the result of the last line executed by
+	// Main.
+	lastStatus ExitStatus
+	lastErr    error
+
+	// jobs holds the job table, ordered by ID.
+	jobs []*Job
+
+	// mutex guards variables, aliases, history, the result of the last line,
+	// and the job table, which may be accessed by several commands running
+	// concurrently within a pipeline or in the background.
+	mutex sync.RWMutex
 }
 
 // NewApp creates an App and configures its logger. The first argument defines
@@ -70,6 +243,7 @@ func NewApp(name string, addDefaults bool) *App {
 		Output:    os.Stdout,
 		ErrOutput: os.Stderr,
 		Input:     os.Stdin,
+		Banner:    DefaultBanner,
 	}
 
 	if addDefaults {
@@ -102,15 +276,20 @@ func (app *App) Println(a ...interface{}) {
 }
 
 // GetByName takes a string and returns a pointer to a command or an error if
-// no command by that name exists.
+// no command by that name exists. Commands may also be fetched by any of their
+// aliases or, if the App allows abbreviations, by a prefix of either. If the
+// prefix is shared by several commands an ErrAmbiguousCmd is returned.
 func (app *App) GetByName(name string) (*Command, error) {
-	for _, cmd := range app.Commands {
-		if name == cmd.Name {
-			return cmd, nil
-		}
+	cmd, err := findCommand(app.Commands, name, app.AllowAbbreviations)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("App.GetByName: command '%s' does not exist", name)
+	if cmd == nil {
+		return nil, fmt.Errorf("App.GetByName: command '%s' does not exist", name)
+	}
+
+	return cmd, nil
 }
 
 // getDefaults takes a FlagSet and returns a string containing the result of
@@ -131,137 +310,342 @@ func getShortDefaults(flags *flag.FlagSet) string {
 	flags.VisitAll(func(item *flag.Flag) {
 		fmt.Fprintf(output, " [-%s]", item.Name)
 	})
-	return output.String()[1:]
+	return strings.TrimPrefix(output.String(), " ")
 }
 
-// AddCommand takes a Command and adds it to the App. If the command or any of
-// its sub-commands are invalid an error is returned.
+// AddCommand takes a Command and adds it to the App. Sub-commands may be
+// nested to any depth. If the command or any of its sub-commands are invalid,
+// or if the name or an alias of any collides with that of another command at
+// the same level, an error is returned.
 func (app *App) AddCommand(cmd Command) error {
-	if _, err := app.GetByName(cmd.Name); err == nil {
-		return fmt.Errorf("App.AddCommand: '%s' already exists", cmd.Name)
+	for _, name := range cmd.names() {
+		if other, _ := findCommand(app.Commands, name, false); other != nil {
+			return fmt.Errorf("App.AddCommand: '%s' already exists", name)
+		}
+
+		if _, ok := app.Alias(name); ok {
+			return fmt.Errorf("App.AddCommand: '%s' already exists as an alias", name)
+		}
 	}
 
+	if err := app.prepareCommand(&cmd, nil); err != nil {
+		return err
+	}
+
+	app.Commands = append(app.Commands, &cmd)
+
+	return nil
+}
+
+// prepareCommand takes a pointer to a Command and its parent, if any, and
+// validates the Command, attaches it to the App, adds default sub-commands,
+// and parses the templates in its Usage field. The same is then done for each
+// of its sub-commands in turn.
+func (app *App) prepareCommand(cmd *Command, parent *Command) error {
+	for _, name := range cmd.names() {
+		if name == "" {
+			return fmt.Errorf("App.AddCommand: (sub-)command name or alias cannot be blank")
+		}
+
+		spaces := 0
+		// Count whitespace in command name
+		for _, char := range name {
+			if unicode.IsSpace(char) {
+				spaces++
+			}
+		}
+
+		if spaces > 0 {
+			return fmt.Errorf("App.AddCommand: (sub-)command name or alias '%s' contains %d disallowed whitespace characters", name, spaces)
+		}
+
+		// if sub-command has name beginning with '-', return an error
+		if parent != nil && name[0] == '-' {
+			return fmt.Errorf("App.AddCommand: sub-commands must not begin with the character '-'")
+		}
+	}
+
+	// if command is missing Main function, return an error
+	if cmd.Main == nil {
+		return fmt.Errorf("App.AddCommand: 'Main' function for (sub-)command '%s' is nil", cmd.Name)
+	}
+
+	if err := validateArgs(cmd.Name, cmd.Args); err != nil {
+		return err
+	}
+
+	cmd.parent = parent
+	cmd.app = app
+
 	if len(cmd.SubCommands) > 0 {
+		// Copy sub-commands so that those of the Command passed to AddCommand
+		// are left untouched
+		subCommands := make([]Command, len(cmd.SubCommands), len(cmd.SubCommands)+len(DefaultSubCommands))
+		copy(subCommands, cmd.SubCommands)
+
 		// Add default sub-commands
 		if cmd.PreventDefaultSubCommands != true {
 			for _, def := range DefaultSubCommands {
 				switch def.Name {
 				case "flags":
-					for _, item := range append(cmd.SubCommands, cmd) {
-						if item.SetFlags != nil {
-							cmd.SubCommands = append(cmd.SubCommands, def)
+					for _, item := range append(subCommands, *cmd) {
+						if item.hasFlags(app) {
+							subCommands = append(subCommands, def)
+							break
 						}
 					}
 				default:
-					cmd.SubCommands = append(cmd.SubCommands, def)
+					subCommands = append(subCommands, def)
 				}
 			}
 		}
 
-		for key := range cmd.SubCommands {
-			subCmd := &cmd.SubCommands[key]
-			// if any sub-commands have name beginning with '-', return an error
-			if subCmd.Name != "" && subCmd.Name[0] == '-' {
-				return fmt.Errorf("App.AddCommand: sub-commands must not begin with the character '-'")
-			}
+		cmd.SubCommands = subCommands
 
-			// if any sub-commands contain second-level sub-commands, return an error
-			if len(subCmd.SubCommands) > 0 {
-				return fmt.Errorf("App.AddCommand: '%s' contains more than one level of sub-commands", cmd.Name)
+		// if any sub-command alias collides with another sub-command, return an error
+		for key, subCmd := range cmd.SubCommands {
+			for _, alias := range subCmd.Aliases {
+				for other := range cmd.SubCommands {
+					if other != key && cmd.SubCommands[other].hasName(alias) {
+						return fmt.Errorf("App.AddCommand: alias '%s' of '%s' collides with sub-command '%s'", alias,
+							subCmd.Name, cmd.SubCommands[other].Name)
+					}
+				}
 			}
-
-			subCmd.parent = &cmd
 		}
 	}
 
-	items := append(make([]*Command, 0), &cmd)
-	for key := range cmd.SubCommands {
-		items = append(items, &cmd.SubCommands[key])
+	// Parse templates in Usage field
+	cmd.Usage = strings.ReplaceAll(cmd.Usage, "${name}", cmd.Name)
+	cmd.Usage = strings.ReplaceAll(cmd.Usage, "${fullName}", cmd.FullName())
+	cmd.Usage = strings.ReplaceAll(cmd.Usage, "${args}", getArgsUsage(cmd.Args))
+
+	// report any flag which is redefined now rather than when the command runs
+	if err := cmd.checkFlags(); err != nil {
+		return err
 	}
 
-	for _, item := range items {
-		if item.Name == "" {
-			return fmt.Errorf("App.AddCommand: (sub-)command name cannot be blank")
+	// only the command's own flags are described within its usage
+	cmdCtx := cmd.NewContext()
+	if cmd.SetFlags != nil || cmd.PersistentFlags != nil || cmd.Options != nil {
+		if err := cmd.setLocalFlags(cmdCtx); err != nil {
+			return fmt.Errorf("App.AddCommand: invalid Options for (sub-)command '%s':\n%s", cmd.Name, err)
 		}
 
-		spaces := 0
-		// Count whitespace in command name
-		for _, char := range item.Name {
-			if unicode.IsSpace(char) {
-				spaces++
-			}
+		if cmd.gnuFlags() {
+			cmd.Usage = strings.ReplaceAll(cmd.Usage, "${flags}", getGNUDefaults(cmdCtx.FlagSet(), cmdCtx.shortFlags))
+			cmd.Usage = strings.ReplaceAll(cmd.Usage, "${shortFlags}",
+				getGNUShortDefaults(cmdCtx.FlagSet(), cmdCtx.shortFlags))
+		} else {
+			cmd.Usage = strings.ReplaceAll(cmd.Usage, "${flags}", getDefaults(cmdCtx.FlagSet()))
+			cmd.Usage = strings.ReplaceAll(cmd.Usage, "${shortFlags}", getShortDefaults(cmdCtx.FlagSet()))
 		}
+	} else {
+		cmd.Usage = strings.ReplaceAll(cmd.Usage, "${flags}", "")
+		cmd.Usage = strings.ReplaceAll(cmd.Usage, "${shortFlags}", "")
+		cmd.Usage = strings.TrimSpace(cmd.Usage)
+	}
 
-		if spaces > 0 {
-			return fmt.Errorf("App.AddCommand: (sub-)command name '%s' contains %d disallowed whitespace characters", item.Name, spaces)
+	for key := range cmd.SubCommands {
+		if err := app.prepareCommand(&cmd.SubCommands[key], cmd); err != nil {
+			return err
 		}
+	}
 
-		// if any commands are missing Main functions, return an error
-		if item.Main == nil {
-			return fmt.Errorf("App.AddCommand: 'Main' function for (sub-)command '%s' is nil", item.Name)
-		}
+	return nil
+}
 
-		item.app = app
+// ExecuteString takes what is usually some user input and attempts to execute
+// a command based on the input. The input is split into arguments at unquoted
+// whitespace, with quotes and backslash escapes handled in the manner of a
+// POSIX shell. App variables referenced as $NAME or ${NAME} outside of single
+// quotes are expanded immediately before each pipeline is run. If no matching
+// command exists an ErrNoCmd is returned, holding suggestions of similarly
+// named commands, and if the App allows abbreviations
+// and a command is called by an ambiguous prefix an ErrAmbiguousCmd is
+// returned. If the input string is invalid an
+// ErrParseInput is returned. If a command is successfully executed, it's
+// ExitStatus is returned, otherwise ExecuteString defaults to ExitCmd. An
+// ErrParseFlags may be returned in event of a failure when parsing the input
+// flags, an ErrInvalidFlag if the flags do not satisfy the constraints of the
+// command, an ErrParseArgs if the remaining arguments do not satisfy the Args
+// of the command, and an ErrTimeout if a command runs for longer than its
+// timeout.
+//
+// Several commands may be connected with '|' to form a pipeline, in which case
+// each command is run concurrently with its Context Output connected to the
+// Input of the next. The first command receives an empty Input and the last
+// writes to the App's Output. The ExitStatus of the last command is returned
+// along with the first error returned by any command in the order in which
+// they appear. No command is run if any of them cannot be matched.
+//
+// Several pipelines may be separated with ';', '&&', or '||'. Those following
+// ';' are always run, those following '&&' only if the last pipeline to run
+// returned ExitCmd and no error, and those following '||' only if it did not,
+// such as when it returned ExitUsage, ExitFailure, ErrParseFlags, or ErrNoCmd.
+// A pipeline returning ExitShell or ExitAll stops the chain immediately. The
+// ExitStatus and error of the last pipeline to run are returned, while errors
+// from those before it are printed to the App's ErrOutput as they occur.
+//
+// A list of pipelines ending with '&' is run in the background as a job, in
+// which case the next pipeline is run immediately as if it had returned
+// ExitCmd. Jobs are added to the App's job table and may be managed with
+// Jobs, Job, and the default jobs, fg, wait, and kill commands.
+//
+// The Input, Output, and ErrOutput seen by a single command may be replaced
+// with a file using '<', '>' or '>>', and '2>' respectively, where '>'
+// truncates the file and '>>' appends to it. All files within a pipeline are
+// opened before any command is run, and an ErrRedirect is returned if any
+// cannot be opened.
+//
+// Outside of single quotes, $(input) is replaced with the output of running
+// input as with ExecuteString, less any trailing newlines. The output is split
+// into several arguments at whitespace unless the substitution is within
+// double quotes. If the command returns an error or an ExitStatus other than
+// ExitCmd, an ErrSubstitution is returned and the command containing the
+// substitution is not run.
+func (app *App) ExecuteString(input string) (ExitStatus, error) {
+	return app.ExecuteContext(context.Background(), input)
+}
 
-		// Parse templates in Usage field
-		item.Usage = strings.ReplaceAll(item.Usage, "${name}", item.Name)
-		item.Usage = strings.ReplaceAll(item.Usage, "${fullName}", item.FullName())
+// ExecuteContext does the same as ExecuteString but runs each command with the
+// context.Context provided, available through Context.Context. Once it is
+// cancelled no further pipelines are run and its error is returned.
+func (app *App) ExecuteContext(ctx context.Context, input string) (ExitStatus, error) {
+	return app.execute(ctx, input, app.Output, app.ErrOutput, nil)
+}
 
-		itemCtx := item.NewContext()
-		if item.SetFlags != nil {
-			item.SetFlags(itemCtx)
+// execute does the same as ExecuteContext but writes the output of the last
+// command in each pipeline and the error output of every command to the
+// writers provided rather than the App's Output and ErrOutput. Errors from
+// pipelines other than the last to run are passed to report as with runChain.
+func (app *App) execute(ctx context.Context, input string, output, errOutput io.Writer,
+	report func(error)) (ExitStatus, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return ExitCmd, err
+	}
 
-			item.Usage = strings.ReplaceAll(item.Usage, "${flags}", getDefaults(itemCtx.FlagSet()))
-			item.Usage = strings.ReplaceAll(item.Usage, "${shortFlags}", getShortDefaults(itemCtx.FlagSet()))
-		} else {
-			item.Usage = strings.ReplaceAll(item.Usage, "${flags}", "")
-			item.Usage = strings.ReplaceAll(item.Usage, "${shortFlags}", "")
-			item.Usage = strings.TrimSpace(item.Usage)
-		}
+	if len(tokens) == 0 {
+		return ExitCmd, &ErrParseInput{Input: input, Reason: "input is empty"}
 	}
 
-	app.Commands = append(app.Commands, &cmd)
+	links, err := parseChain(input, tokens)
+	if err != nil {
+		return ExitCmd, err
+	}
 
-	return nil
+	return app.runChain(ctx, links, output, errOutput, report)
 }
 
-// ExecuteString takes what is usually some user input and attempts to execute
-// a command based on the input. If no matching command exists an ErrNoCmd is
-// returned. If the input string is invalid an ErrParseInput is returned. If a
-// command is successfully executed, it's ExitStatus is returned, otherwise
-// ExecuteString defaults to ExitCmd. An ErrParseFlags may be returned in event
-// of a failure when parsing the input flags.
-func (app *App) ExecuteString(input string) (ExitStatus, error) {
-	split := strings.Fields(input)
-	if len(split) > 0 {
-		for _, cmd := range app.Commands {
-			if item, err := cmd.Match(split); err == nil {
-				// if item has a parent it is a sub-command, pass split from the second string onward
-				if item.parent != nil {
-					return item.Execute(split[1:])
-				}
+// printError prints a short message describing an error returned while
+// executing some input to errOutput, usually the App's ErrOutput.
+func (app *App) printError(errOutput io.Writer, err error) {
+	// if execution was interrupted, print("interrupted")
+	if err == context.Canceled {
+		fmt.Fprintln(errOutput, "interrupted")
+		return
+	}
 
-				return item.Execute(split)
-			}
+	// switch err type:
+	//	is flag parse error => print("%s: failed to parse flags") followed by suggestions
+	//	is argument parse error => print("%s: <%s>: %s")
+	//	is invalid flag error => print("%s: %s%s: %s")
+	//	is timeout error => print("%s: timed out")
+	//	is no matching command error => print("%s: command not found") followed by suggestions
+	//	is ambiguous command error => print("%s: ambiguous command")
+	//	is failed to parse input error => print("failed to parse input")
+	//	is history expansion error => print("%s: event not found")
+	//	is redirection error => print("%s: cannot redirect")
+	//	is command substitution error => print the inner error
+	//	is script error => print("%s:%d: ") followed by the inner error
+	switch val := err.(type) {
+	case *ErrParseFlags:
+		fmt.Fprintf(errOutput, "%s: failed to parse flags:\n%s\n", val.Name, val.Err)
+		app.printSuggestions(errOutput, val.Suggestions)
+	case *ErrParseArgs:
+		if val.Arg == "" {
+			fmt.Fprintf(errOutput, "%s: %s\n", val.Name, val.Reason)
+		} else if val.Value == "" {
+			fmt.Fprintf(errOutput, "%s: <%s>: %s\n", val.Name, val.Arg, val.Reason)
+		} else {
+			fmt.Fprintf(errOutput, "%s: <%s>: %s, got '%s'\n", val.Name, val.Arg, val.Reason, val.Value)
+		}
+	case *ErrInvalidFlag:
+		if val.Value != "" {
+			fmt.Fprintf(errOutput, "%s: %s%s: %s, got '%s'\n", val.Name, val.Prefix, val.Flag, val.Reason, val.Value)
+		} else {
+			fmt.Fprintf(errOutput, "%s: %s%s: %s\n", val.Name, val.Prefix, val.Flag, val.Reason)
+		}
+	case *ErrTimeout:
+		fmt.Fprintf(errOutput, "%s: timed out after %s\n", val.Name, val.Timeout)
+	case *ErrNoCmd:
+		fmt.Fprintf(errOutput, "%s: command not found\n", val.Name)
+		app.printSuggestions(errOutput, val.Suggestions)
+	case *ErrAmbiguousCmd:
+		fmt.Fprintf(errOutput, "%s: ambiguous command, could be: %s\n", val.Name, strings.Join(val.Candidates, ", "))
+	case *ErrParseInput:
+		fmt.Fprintf(errOutput, "failed to parse input: %s at position %d\n", val.Reason, val.Position)
+	case *ErrNoEvent:
+		fmt.Fprintf(errOutput, "%s: event not found\n", val.Event)
+	case *ErrRedirect:
+		fmt.Fprintf(errOutput, "%s: cannot redirect: %s\n", val.Path, val.Err)
+	case *ErrScript:
+		fmt.Fprintf(errOutput, "%s:%d: ", val.Name, val.Line)
+		app.printError(errOutput, val.Err)
+	case *ErrSubstitution:
+		if val.Err != nil {
+			app.printError(errOutput, val.Err)
+		} else {
+			fmt.Fprintf(errOutput, "$(%s): command did not succeed\n", val.Input)
 		}
+	default:
+		fmt.Fprintln(errOutput, err)
+	}
+}
 
-		return ExitCmd, &ErrNoCmd{Name: split[0]}
+// printSuggestions prints a list of suggestions, if any, to errOutput.
+func (app *App) printSuggestions(errOutput io.Writer, suggestions []string) {
+	if len(suggestions) == 0 {
+		return
 	}
 
-	return ExitCmd, &ErrParseInput{Input: input}
+	fmt.Fprintf(errOutput, "Did you mean:\n\t%s\n", strings.Join(suggestions, "\n\t"))
 }
 
 // Main is the App's main loop. It accepts user input infinitely until some
-// command returns an ExitStatus of ExitShell. Any errors that occur are not
-// propagated back up but rather printed to the App's Output.
+// command returns an ExitStatus of ExitShell or the input ends, such as when
+// the user presses Ctrl-D. Pressing Ctrl-C clears the current line, or while
+// a line is being executed cancels the context.Context of each of its
+// commands as with Interrupt. Any errors that occur are not propagated back up
+// but rather printed to the App's ErrOutput. The names of commands, sub-
+// commands, and flags may be completed by pressing tab.
+//
+// History is loaded as with LoadHistory before the first line is read. Each
+// line has its history references expanded as with ExpandHistory, in which
+// case the expanded line is printed, and is then added to the history as with
+// AddHistory before it is executed.
+//
+// Before each prompt, each job which has finished is announced along with its
+// state and any error, after the output which it buffered is written to the
+// App's Output.
 func (app *App) Main() ExitStatus {
-	app.Println("Welcome to the shell. Type \"help\" for available Commands.")
+	if app.Banner != "" {
+		app.Println(app.Banner)
+	}
+
+	if err := app.LoadHistory(); err != nil {
+		app.printError(app.ErrOutput, err)
+	}
 
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt: "> ",
-		Stdin:  app.Input,
-		Stdout: app.Output,
-		Stderr: app.ErrOutput,
+		Prompt:                 app.prompt(),
+		Stdin:                  app.Input,
+		Stdout:                 app.Output,
+		Stderr:                 app.ErrOutput,
+		AutoComplete:           &completer{app: app},
+		HistoryLimit:           app.historySize(),
+		DisableAutoSaveHistory: true,
 	})
 
 	if err != nil {
@@ -270,37 +654,184 @@ func (app *App) Main() ExitStatus {
 
 	defer rl.Close()
 
+	synced := app.syncHistory(rl, nil)
+	interrupted := false
 	for {
+		app.announceJobs()
+		rl.SetPrompt(app.prompt())
 		input, err := rl.Readline()
-		if err != nil { // error is io.EOF or readline.ErrInterrupt
+		if err == readline.ErrInterrupt {
+			// exit on a second consecutive interrupt at an empty prompt if allowed
+			if app.ExitOnDoubleInterrupt && input == "" {
+				if interrupted {
+					return ExitShell
+				}
+
+				fmt.Fprintln(app.ErrOutput, "(press Ctrl-C again to exit)")
+			}
+
+			interrupted = input == ""
+			continue
+		} else if err != nil { // error is io.EOF
 			return ExitShell
 		}
 
+		interrupted = false
+
 		// if input is blank, ignore
 		if strings.TrimSpace(input) == "" {
 			continue
 		}
 
-		exitStatus, err := app.ExecuteString(input)
+		expanded, err := app.ExpandHistory(input)
+		if err != nil {
+			app.printError(app.ErrOutput, err)
+			continue
+		}
 
-		// switch err type:
-		//	is flag parse error => app.print
-		//	is no matching command error => print("%s: command not found")
-		//	is failed to parse input error => print("failed to parse input")
+		// if any history references were expanded, print the result
+		if expanded != input {
+			app.Println(expanded)
+			input = expanded
+		}
 
+		if err := app.AddHistory(input); err != nil {
+			app.printError(app.ErrOutput, err)
+		}
+
+		exitStatus, err := app.executeInterruptible(input)
 		if err != nil {
-			switch val := err.(type) {
-			case *ErrParseFlags:
-				app.Printf("%s: failed to parse flags:\n%s", val.Name, val.Err)
-			case *ErrNoCmd:
-				app.Printf("%s: command not found", val.Name)
-			default:
-				app.Println(err)
-			}
+			app.printError(app.ErrOutput, err)
 		}
 
-		if exitStatus != ExitCmd && exitStatus != ExitUsage {
+		app.mutex.Lock()
+		app.lastStatus, app.lastErr = exitStatus, err
+		app.mutex.Unlock()
+
+		synced = app.syncHistory(rl, synced)
+
+		if exitStatus == ExitShell || exitStatus == ExitAll {
 			return exitStatus
 		}
 	}
 }
+
+// executeInterruptible executes the input as with ExecuteContext, cancelling
+// the context.Context of each command if the process receives SIGINT or
+// Interrupt is called before it completes.
+func (app *App) executeInterruptible(input string) (ExitStatus, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app.mutex.Lock()
+	app.interrupt = cancel
+	app.mutex.Unlock()
+
+	defer func() {
+		app.mutex.Lock()
+		app.interrupt = nil
+		app.mutex.Unlock()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return app.ExecuteContext(ctx, input)
+}
+
+// Interrupt cancels the context.Context of the commands currently being run
+// by Main, as happens when the user presses Ctrl-C. If Main is not running any
+// commands, Interrupt does nothing.
+func (app *App) Interrupt() {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	if app.interrupt != nil {
+		app.interrupt()
+	}
+}
+
+// LastStatus returns the ExitStatus and error returned by the last line
+// executed by Main. Before any line is executed, ExitCmd and nil are returned.
+func (app *App) LastStatus() (ExitStatus, error) {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	return app.lastStatus, app.lastErr
+}
+
+// prompt returns the result of PromptFunc if it is not nil, otherwise the
+// evaluated Prompt or DefaultPrompt if it is blank.
+func (app *App) prompt() string {
+	if app.PromptFunc != nil {
+		return app.PromptFunc(app)
+	}
+
+	if app.Prompt == "" {
+		return DefaultPrompt
+	}
+
+	expanded := &strings.Builder{}
+	for pos := 0; pos < len(app.Prompt); {
+		switch {
+		case app.Prompt[pos] != '$':
+			expanded.WriteByte(app.Prompt[pos])
+			pos++
+		case strings.HasPrefix(app.Prompt[pos:], "$?"):
+			fmt.Fprint(expanded, ExitCode(app.LastStatus()))
+			pos += 2
+		default:
+			// invalid variable references are left as is
+			lex := &lexer{input: app.Prompt, pos: pos, expander: &expansion{app: app, ctx: context.Background()}}
+			if value, err := lex.readVariable(); err != nil {
+				expanded.WriteByte('$')
+				pos++
+			} else {
+				expanded.WriteString(value)
+				pos = lex.pos
+			}
+		}
+	}
+
+	return expanded.String()
+}
+
+// Run allows the App to act either as a regular command-line program or as a
+// shell, and is usually called with os.Args[1:]. If no arguments are provided,
+// the main loop is started as with Main. Otherwise, the arguments are matched
+// to a command and executed as with ExecuteString, except that they are not
+// split, expanded, or searched for operators since this has already been done
+// by the shell which started the program. The command's Context Input is the
+// App's Input. Any error is printed to the App's ErrOutput.
+//
+// The ExitStatus and error are mapped to a process exit code as described by
+// ExitCode, and so the result may be passed directly to os.Exit. Since the
+// program is expected to exit once Run returns, both ExitShell and ExitAll
+// result in an exit code of 0, whether returned from Main or the command.
+func (app *App) Run(args []string) int {
+	if len(args) == 0 {
+		return ExitCode(app.Main(), nil)
+	}
+
+	cmd, input, err := app.match(args)
+	if err != nil {
+		app.printError(app.ErrOutput, err)
+		return ExitCode(ExitCmd, err)
+	}
+
+	status, err := (&stage{command: cmd, args: input}).run(app.Input, app.Output, app.ErrOutput)
+	if err != nil {
+		app.printError(app.ErrOutput, err)
+	}
+
+	return ExitCode(status, err)
+}
@@ -1,11 +1,14 @@
 package shell
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var blankSetFlagsFunc = func(ctx *Context) {
@@ -84,8 +87,8 @@ func TestNewApp(t *testing.T) {
 		t.Fatal("App: expected Input default of `os.Stdin`")
 	}
 
-	if len(app.Commands) != 2 {
-		t.Errorf("App: got %d items in commands expected 2", len(app.Commands))
+	if len(app.Commands) != len(DefaultCommands) {
+		t.Errorf("App: got %d items in commands expected %d", len(app.Commands), len(DefaultCommands))
 	}
 
 	if res, err := app.GetByName("help"); err != nil {
@@ -172,7 +175,10 @@ func TestBadAddCommand(t *testing.T) {
 	subCmdMainTmpl(&Command{Name: "-no"}, "'-' at start of sub-command name", "must not begin with")
 	subCmdMainTmpl(&Command{Name: "second-level", SubCommands: []Command{
 		{Name: "third-level"},
-	}}, "two levels of sub-commands", "more than one level")
+	}}, "third-level sub-command missing main function", "function for (sub-)command 'third-level'")
+	subCmdMainTmpl(&Command{Name: "second-level", SubCommands: []Command{
+		{Name: "-third", Main: blankMainFunc},
+	}}, "'-' at start of third-level sub-command name", "must not begin with")
 }
 
 // TestWorkingAddCommand ensures that no errors are returned with valid
@@ -232,6 +238,299 @@ func TestWorkingCommand(t *testing.T) {
 	}
 }
 
+// TestNestedCommand ensures that sub-commands nested several levels deep are
+// matched and executed with the correct arguments and that default sub-
+// commands are available at every level.
+func TestNestedCommand(t *testing.T) {
+	app := NewApp("TestNestedCommand", false)
+
+	if err := app.AddCommand(Command{
+		Name: "cluster",
+		Main: blankMainFunc,
+		SubCommands: []Command{
+			{
+				Name:     "node",
+				Synopsis: "manage nodes",
+				Main:     blankMainFunc,
+				SubCommands: []Command{
+					{
+						Name:     "drain",
+						Synopsis: "drain a node",
+						Usage:    "${fullName} ${shortFlags} <node>",
+						SetFlags: func(ctx *Context) {
+							ctx.Set("force", ctx.FlagSet().Bool("force", false, "ignore errors"))
+						},
+						Main: func(ctx *Context) ExitStatus {
+							if ctx.FlagSet().NArg() != 1 {
+								return ExitUsage
+							}
+
+							ctx.Println("draining", ctx.FlagSet().Arg(0), *ctx.MustGet("force").(*bool))
+							return ExitCmd
+						},
+					},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error with nested sub-commands:\n", err)
+	}
+
+	cluster, _ := app.GetByName("cluster")
+	node, err := cluster.GetSubCommand("node")
+	if err != nil {
+		t.Fatal("Command.GetSubCommand: got error:\n", err)
+	}
+
+	drain, err := node.GetSubCommand("drain")
+	if err != nil {
+		t.Fatal("Command.GetSubCommand: got error:\n", err)
+	}
+
+	if res := drain.FullName(); res != "cluster node drain" {
+		t.Errorf("Command.FullName: got '%s' expected 'cluster node drain'", res)
+	}
+
+	if drain.Usage != "cluster node drain [-force] <node>" {
+		t.Errorf("Command.Usage: got '%s' expected 'cluster node drain [-force] <node>'", drain.Usage)
+	}
+
+	if res, err := cluster.Match([]string{"cluster", "node", "drain", "a"}); err != nil {
+		t.Error("Command.Match: got error:\n", err)
+	} else if res != drain {
+		t.Errorf("Command.Match: got command '%s' expected 'cluster node drain'", res.FullName())
+	}
+
+	if res, err := cluster.Match([]string{"cluster", "node", "-x", "drain"}); err != nil {
+		t.Error("Command.Match: got error:\n", err)
+	} else if res != node {
+		t.Errorf("Command.Match: got command '%s' expected 'cluster node'", res.FullName())
+	}
+
+	for _, name := range []string{"help", "commands"} {
+		if _, err := node.GetSubCommand(name); err != nil {
+			t.Errorf("Command.GetSubCommand: expected default sub-command '%s' at second level:\n%s", name, err)
+		}
+	}
+
+	MainInput(t, app, "third-level sub-command", "cluster node drain -force a", "draining a true")
+	MainInput(t, app, "third-level sub-command usage", "cluster node drain", "cluster node drain [-force] <node>")
+	MainInput(t, app, "second-level help", "cluster node help", "Usage: cluster node <sub-command>", "drain a node")
+	MainInput(t, app, "second-level help with sub-command", "cluster node help drain", "cluster node drain [-force]")
+	MainInput(t, app, "second-level commands", "cluster node commands", "drain\n")
+	MainInput(t, app, "second-level flags", "cluster node flags drain", "ignore errors")
+	MainInput(t, app, "second-level flags with non-existent sub-command", "cluster node flags none",
+		"cluster node none: sub-command not found")
+}
+
+// TestCommandAliases ensures that commands and sub-commands may be called by
+// their aliases and that colliding aliases are rejected.
+func TestCommandAliases(t *testing.T) {
+	app := NewApp("TestCommandAliases", true)
+
+	if err := app.AddCommand(Command{
+		Name:    "rm",
+		Aliases: []string{"remove", "del"},
+		Main: func(ctx *Context) ExitStatus {
+			ctx.Println("removing", ctx.FlagSet().Args())
+			return ExitCmd
+		},
+		SubCommands: []Command{
+			{
+				Name:     "all",
+				Aliases:  []string{"everything"},
+				Synopsis: "remove everything",
+				Main: func(ctx *Context) ExitStatus {
+					ctx.Println("removing everything")
+					return ExitCmd
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error with aliases:\n", err)
+	}
+
+	if cmd, err := app.GetByName("del"); err != nil {
+		t.Error("App.GetByName: got error with alias:\n", err)
+	} else if cmd.Name != "rm" {
+		t.Errorf("App.GetByName: got command '%s' with alias expected 'rm'", cmd.Name)
+	}
+
+	MainInput(t, app, "command alias", "remove a b", "removing [a b]")
+	MainInput(t, app, "sub-command alias", "del everything", "removing everything")
+	MainInput(t, app, "help with sub-command alias", "rm help everything", "remove everything")
+	MainInput(t, app, "prefix without abbreviations", "rem a", "rem: command not found")
+
+	expectError := func(cmd Command, msg, substr string) {
+		if err := app.AddCommand(cmd); err == nil {
+			t.Errorf("App.AddCommand: expected error with %s", msg)
+		} else if !strings.Contains(err.Error(), substr) {
+			t.Errorf("App.AddCommand: expected error message with %s to contain substring '%s' got:\n%s", msg,
+				substr, err)
+		}
+	}
+
+	expectError(Command{Name: "remove", Main: blankMainFunc}, "name of existing alias", "'remove' already exists")
+	expectError(Command{Name: "erase", Aliases: []string{"del"}, Main: blankMainFunc}, "existing alias",
+		"'del' already exists")
+	expectError(Command{Name: "quit", Aliases: []string{"exit"}, Main: blankMainFunc}, "name of existing command",
+		"'exit' already exists")
+	expectError(Command{Name: "erase", Aliases: []string{"a b"}, Main: blankMainFunc}, "whitespace in alias",
+		"disallowed whitespace")
+	expectError(Command{Name: "erase", Main: blankMainFunc, SubCommands: []Command{
+		{Name: "one", Main: blankMainFunc},
+		{Name: "two", Aliases: []string{"one"}, Main: blankMainFunc},
+	}}, "alias of sub-command colliding with another", "collides with sub-command 'one'")
+	expectError(Command{Name: "erase", Main: blankMainFunc, SubCommands: []Command{
+		{Name: "one", Aliases: []string{"help"}, Main: blankMainFunc},
+	}}, "alias of sub-command colliding with default sub-command", "collides with sub-command 'help'")
+
+	if err := app.AddAlias("del", "help"); err == nil {
+		t.Error("App.AddAlias: expected error with name of existing command alias")
+	}
+}
+
+// TestAbbreviations ensures that commands and sub-commands may be called by
+// unambiguous prefixes only if the App allows abbreviations.
+func TestAbbreviations(t *testing.T) {
+	app := NewApp("TestAbbreviations", true)
+	app.AllowAbbreviations = true
+
+	for _, cmd := range []Command{
+		{
+			Name: "show",
+			Main: blankMainFunc,
+			SubCommands: []Command{
+				{Name: "interfaces", Main: func(ctx *Context) ExitStatus {
+					ctx.Println("interfaces", ctx.FlagSet().Args())
+					return ExitCmd
+				}},
+				{Name: "interrupts", Main: blankMainFunc},
+				{Name: "version", Aliases: []string{"ver"}, Main: blankMainFunc},
+			},
+		},
+		{Name: "shutdown", Main: blankMainFunc},
+		{Name: "status", Aliases: []string{"state"}, Main: blankMainFunc},
+	} {
+		if err := app.AddCommand(cmd); err != nil {
+			t.Fatal("App.AddCommand: got error:\n", err)
+		}
+	}
+
+	expect := func(name, result string) {
+		if cmd, err := app.GetByName(name); err != nil {
+			t.Errorf("App.GetByName: got error with '%s':\n%s", name, err)
+		} else if cmd.Name != result {
+			t.Errorf("App.GetByName: got command '%s' with '%s' expected '%s'", cmd.Name, name, result)
+		}
+	}
+
+	expect("sho", "show")
+	expect("shu", "shutdown")
+	expect("stat", "status")
+	expect("sta", "status")
+
+	if _, err := app.GetByName("sh"); err == nil {
+		t.Error("App.GetByName: expected error with ambiguous prefix")
+	} else if val, ok := err.(*ErrAmbiguousCmd); !ok {
+		t.Error("App.GetByName: expected error of type *ErrAmbiguousCmd with ambiguous prefix:\n", err)
+	} else if !reflect.DeepEqual(val.Candidates, []string{"show", "shutdown"}) {
+		t.Errorf("App.GetByName: got candidates %q expected 'show' and 'shutdown'", val.Candidates)
+	}
+
+	MainInput(t, app, "abbreviated command and sub-command", "sho interf a", "interfaces [a]")
+	MainInput(t, app, "ambiguous command", "sh int", "sh: ambiguous command, could be: show, shutdown")
+	MainInput(t, app, "ambiguous sub-command", "sho inter", "inter: ambiguous command, could be: interfaces, interrupts")
+	MainInput(t, app, "help with ambiguous command", "help sh", "sh: ambiguous command, could be: show, shutdown")
+
+	if _, err := app.ExecuteString("sho inter"); ExitCode(ExitCmd, err) != 127 {
+		t.Errorf("ExitCode: got %d with ambiguous sub-command expected 127", ExitCode(ExitCmd, err))
+	}
+}
+
+// TestSuggestions ensures that misspelled commands, sub-commands, and flags
+// result in errors holding suggestions which are printed by Main.
+func TestSuggestions(t *testing.T) {
+	app := NewApp("TestSuggestions", true)
+
+	if err := app.AddCommand(TmplCmdWithSubCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect := func(input string, errType error, suggestions ...string) {
+		_, err := app.ExecuteString(input)
+
+		var res []string
+		switch val := err.(type) {
+		case *ErrNoCmd:
+			res = val.Suggestions
+		case *ErrParseFlags:
+			res = val.Suggestions
+		}
+
+		if reflect.TypeOf(err) != reflect.TypeOf(errType) {
+			t.Errorf("App.ExecuteString: expected error of type %T with input `%s` got:\n%s", errType, input, err)
+		} else if (len(res) > 0 || len(suggestions) > 0) && !reflect.DeepEqual(res, suggestions) {
+			t.Errorf("App.ExecuteString: got suggestions %q with input `%s` expected %q", res, input, suggestions)
+		}
+	}
+
+	expect("tset", &ErrNoCmd{}, "set", "test")
+	expect("hlep", &ErrNoCmd{}, "help")
+	expect("test secnodary", &ErrNoCmd{}, "secondary")
+	expect("test -top 1 secnodary", &ErrNoCmd{}, "secondary")
+	expect("test -tpo 1", &ErrParseFlags{}, "-top")
+	expect("test secondary -seconds 1", &ErrParseFlags{}, "-second")
+	expect("nothing", &ErrNoCmd{})
+
+	if _, err := app.ExecuteString("test secnodary"); err == nil || err.(*ErrNoCmd).Name != "test secnodary" {
+		t.Errorf("App.ExecuteString: expected ErrNoCmd with name 'test secnodary' got:\n%s", err)
+	}
+
+	if _, err := app.ExecuteString("test different"); err != nil {
+		t.Error("App.ExecuteString: got error with argument unlike any sub-command:\n", err)
+	}
+
+	MainInput(t, app, "misspelled command", "tset", "tset: command not found\nDid you mean:\n\tset\n\ttest\n")
+	MainInput(t, app, "misspelled flag", "test -tpo 1", "Did you mean:\n\t-top\n")
+
+	// a command with sub-commands which accepts the argument is run as usual
+	if err := app.AddCommand(Command{
+		Name: "open",
+		Args: []Arg{{Name: "file", Required: true}},
+		Main: func(ctx *Context) ExitStatus {
+			ctx.Println("opening", ctx.Arg("file"))
+			return ExitCmd
+		},
+		SubCommands: []Command{{Name: "recent", Main: blankMainFunc}},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	output := &strings.Builder{}
+	app.Output = output
+	for _, input := range []string{"open helps", "open recnet"} {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err != nil {
+			t.Errorf("App.ExecuteString: got error with argument resembling a sub-command `%s`:\n%s", input, err)
+		} else if res, expected := output.String(), "opening "+strings.Fields(input)[1]+"\n"; res != expected {
+			t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", res, input, expected)
+		}
+	}
+
+	if err := app.AddCommand(Command{
+		Name:        "count",
+		Args:        []Arg{{Name: "n", Type: ArgInt}},
+		Main:        blankMainFunc,
+		SubCommands: []Command{{Name: "recent", Main: blankMainFunc}},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect("count recnet", &ErrNoCmd{}, "recent")
+	expect("count many", &ErrParseArgs{})
+}
+
 // TestTemplateReplacement tests whether templates in the Usage field of
 // commands is properly replaced.
 func TestTemplateReplacement(t *testing.T) {
@@ -293,6 +592,29 @@ func TestExecuteString(t *testing.T) {
 		} else if _, ok := err.(*ErrParseFlags); !ok {
 			t.Error("App.ExecuteString: expected error of type *ErrParseFlags with invalid flags:\n", err)
 		}
+
+		if _, err := app.ExecuteString("test 'unterminated"); err == nil {
+			t.Error("App.ExecuteString: expected error with unterminated quote")
+		} else if val, ok := err.(*ErrParseInput); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrParseInput with unterminated quote:\n", err)
+		} else if val.Position != 5 {
+			t.Errorf("App.ExecuteString: got position %d with unterminated quote expected 5", val.Position)
+		}
+	}
+
+	var args []string
+	if err := app.AddCommand(Command{
+		Name: "args",
+		Main: func(ctx *Context) ExitStatus {
+			args = ctx.FlagSet().Args()
+			return ExitCmd
+		},
+	}); err != nil {
+		t.Error("App.AddCommand: got error:\n", err)
+	} else if _, err := app.ExecuteString(`args "buy milk" 'a "b"' c\ d`); err != nil {
+		t.Error("App.ExecuteString: got error with quoted arguments:\n", err)
+	} else if len(args) != 3 || args[0] != "buy milk" || args[1] != `a "b"` || args[2] != "c d" {
+		t.Errorf("App.ExecuteString: got arguments %q with quoted arguments", args)
 	}
 }
 
@@ -307,6 +629,9 @@ func TestMain(t *testing.T) {
 		MainInput(t, app, "'test' with invalid flags", "test ---hello\n", "failed to parse flags")
 		MainInput(t, app, "with a non-existent command", "nothing\n", "command not found")
 		MainInput(t, app, "with empty input", "\n")
+		MainInput(t, app, "with unterminated quote", "test \"hello\n", "unterminated double quote")
+		MainInput(t, app, "with a sequence of commands", "nothing || test\n", "command not found",
+			"Hello world from test command!")
 	}
 
 	exitCmd := TmplSimpleCmd
@@ -328,3 +653,248 @@ func TestMain(t *testing.T) {
 		}
 	}
 }
+
+// TestPrompt ensures that the prompt is evaluated with App variables and the
+// exit code of the last line, and that the banner may be replaced.
+func TestPrompt(t *testing.T) {
+	app := NewApp("TestPrompt", true)
+
+	expect := func(result string) {
+		if res := app.prompt(); res != result {
+			t.Errorf("App.prompt: got '%s' with Prompt '%s' expected '%s'", res, app.Prompt, result)
+		}
+	}
+
+	expect(DefaultPrompt)
+
+	app.Prompt = "[$mode ${mode}x $? $$ $ ${bad name} $(cmd) ünï] "
+	expect("[ x 0 $$ $ ${bad name} $(cmd) ünï] ")
+
+	app.SetVariable("mode", "config")
+	MainInputWithStatus(t, app, "prompt with failing line", "nothing", ExitShell)
+	expect("[config configx 127 $$ $ ${bad name} $(cmd) ünï] ")
+
+	if status, err := app.LastStatus(); status != ExitCmd {
+		t.Errorf("App.LastStatus: got ExitStatus %d expected %d", status, ExitCmd)
+	} else if _, ok := err.(*ErrNoCmd); !ok {
+		t.Error("App.LastStatus: expected error of type *ErrNoCmd:\n", err)
+	}
+
+	app.PromptFunc = func(app *App) string {
+		status, _ := app.LastStatus()
+		return fmt.Sprintf("%s(%d)# ", app.Name, status)
+	}
+	MainInput(t, app, "prompt function with succeeding line", "help exit")
+	expect("TestPrompt(0)# ")
+
+	if !strings.Contains(mainOutput(app, "help"), DefaultBanner) {
+		t.Error("App.Main: expected output to contain DefaultBanner")
+	}
+
+	app.Banner = "Acme Router CLI"
+	if res := mainOutput(app, "help"); !strings.HasPrefix(res, "Acme Router CLI\n") {
+		t.Errorf("App.Main: expected output to begin with custom banner got:\n%s", res)
+	}
+
+	app.Banner = ""
+	if res := mainOutput(app, "help"); strings.Contains(res, DefaultBanner) || !strings.HasPrefix(res, "Available") {
+		t.Errorf("App.Main: expected output to not contain a banner got:\n%s", res)
+	}
+}
+
+// mainOutput takes an App and an input string and returns the output of
+// running the input string via App.Main.
+func mainOutput(app *App, in string) string {
+	output := &strings.Builder{}
+	app.Output = output
+	app.Input = ioutil.NopCloser(strings.NewReader(in))
+	app.Main()
+	return output.String()
+}
+
+// TestInterrupt ensures that commands are cancelled by App.Interrupt and that
+// Ctrl-C at the prompt only exits Main when ExitOnDoubleInterrupt is true.
+func TestInterrupt(t *testing.T) {
+	app := NewApp("TestInterrupt", true)
+
+	if err := app.AddCommand(Command{
+		Name: "block",
+		Main: func(ctx *Context) ExitStatus {
+			// interrupt as though the user pressed Ctrl-C
+			go ctx.App().Interrupt()
+
+			select {
+			case <-ctx.Context().Done():
+				ctx.Println("cancelled")
+			case <-time.After(5 * time.Second):
+				ctx.Println("timed out")
+			}
+
+			return ExitCmd
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	MainInput(t, app, "interrupted command", "block; help exit", "cancelled", "interrupted")
+	if res := mainOutput(app, "block; help exit"); strings.Contains(res, "exit [-shell-only]") {
+		t.Errorf("App.Main: expected line to stop after interrupted command got:\n%s", res)
+	}
+
+	MainInput(t, app, "command after interrupted line", "block\nhelp exit", "exit [-shell-only]")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := app.ExecuteContext(ctx, "help; help"); err != context.Canceled {
+		t.Errorf("App.ExecuteContext: got error %v with cancelled context expected context.Canceled", err)
+	}
+
+	app.Interrupt() // does nothing outside of Main
+
+	if res := mainOutput(app, "help e\x03help exit\n"); !strings.Contains(res, "exit [-shell-only]") ||
+		strings.Contains(res, "help ehelp") {
+		t.Errorf("App.Main: expected Ctrl-C to clear the line got:\n%s", res)
+	}
+
+	if res := mainOutput(app, "\x03\x03help exit\n"); !strings.Contains(res, "exit [-shell-only]") {
+		t.Errorf("App.Main: expected double Ctrl-C to not exit got:\n%s", res)
+	}
+
+	app.ExitOnDoubleInterrupt = true
+	if res := mainOutput(app, "\x03help\x03\x03help exit\n"); !strings.Contains(res, "exit [-shell-only]") {
+		t.Errorf("App.Main: expected Ctrl-C after clearing a line to not exit got:\n%s", res)
+	}
+
+	if res := mainOutput(app, "\x03\x03help exit\n"); strings.Contains(res, "exit [-shell-only]") {
+		t.Errorf("App.Main: expected double Ctrl-C with ExitOnDoubleInterrupt to exit got:\n%s", res)
+	}
+}
+
+// TestTimeout ensures that the context.Context of a command is cancelled once
+// its timeout or that of the App has passed and that an ErrTimeout is
+// returned.
+func TestTimeout(t *testing.T) {
+	app := NewApp("TestTimeout", true)
+
+	slowMain := func(ctx *Context) ExitStatus {
+		select {
+		case <-ctx.Context().Done():
+			ctx.Println("cancelled")
+		case <-time.After(200 * time.Millisecond):
+			ctx.Println("finished")
+		}
+
+		return ExitCmd
+	}
+
+	for _, cmd := range []Command{
+		{Name: "slow", Main: slowMain, Timeout: 10 * time.Millisecond},
+		{Name: "default", Main: slowMain},
+		{Name: "unlimited", Main: slowMain, Timeout: -1},
+	} {
+		if err := app.AddCommand(cmd); err != nil {
+			t.Fatal("App.AddCommand: got error:\n", err)
+		}
+	}
+
+	expect := func(input, result string, timeout time.Duration) {
+		output := &strings.Builder{}
+		app.Output = output
+
+		_, err := app.ExecuteString(input)
+		if timeout == 0 && err != nil {
+			t.Errorf("App.ExecuteString: got error with input `%s`:\n%s", input, err)
+		} else if val, ok := err.(*ErrTimeout); timeout != 0 && (!ok || val.Timeout != timeout) {
+			t.Errorf("App.ExecuteString: expected error of type *ErrTimeout with timeout %s and input `%s`:\n%s",
+				timeout, input, err)
+		} else if output.String() != result {
+			t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", output, input, result)
+		}
+	}
+
+	expect("slow", "cancelled\n", 10*time.Millisecond)
+	expect("default", "finished\n", 0)
+
+	app.Timeout = 20 * time.Millisecond
+	expect("default", "cancelled\n", 20*time.Millisecond)
+	expect("slow", "cancelled\n", 10*time.Millisecond)
+	expect("unlimited", "finished\n", 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := app.ExecuteContext(ctx, "unlimited"); err != nil {
+		t.Error("App.ExecuteContext: expected no error when the parent context times out:\n", err)
+	}
+
+	MainInput(t, app, "command exceeding timeout", "slow", "slow: timed out after 10ms")
+	if _, err := app.ExecuteString("slow"); ExitCode(ExitCmd, err) != 124 {
+		t.Errorf("ExitCode: got %d with ErrTimeout expected 124", ExitCode(ExitCmd, err))
+	}
+}
+
+// TestRun ensures that Run executes commands from arguments and returns the
+// expected exit codes.
+func TestRun(t *testing.T) {
+	app := NewApp("TestRun", true)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+	app.Input = ioutil.NopCloser(strings.NewReader("piped input"))
+
+	if err := app.AddCommand(TmplCmdWithSubCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	if err := app.AddCommand(Command{
+		Name: "cat",
+		Main: func(ctx *Context) ExitStatus {
+			data, _ := ioutil.ReadAll(ctx.Input())
+			ctx.Print(string(data))
+			return ExitCmd
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect := func(args []string, code int, substr string) {
+		output.Reset()
+		if res := app.Run(args); res != code {
+			t.Errorf("App.Run: got exit code %d with arguments %q expected %d", res, args, code)
+		} else if !strings.Contains(output.String(), substr) {
+			t.Errorf("App.Run: expected output with arguments %q to contain '%s' got:\n%s", args, substr, output)
+		}
+	}
+
+	expect([]string{"test", "secondary"}, 0, "Secondary world!")
+	expect([]string{"test", "-top", "5"}, 2, "Hello world! 5")
+	expect([]string{"test", "-top", "a b;c"}, 2, "failed to parse flags")
+	expect([]string{"cat"}, 0, "piped input")
+	expect([]string{"nothing"}, 127, "nothing: command not found")
+	expect([]string{"exit"}, 0, "")
+	expect([]string{"help", "$(exit)"}, 2, "$(exit): command not found")
+
+	app.Input = ioutil.NopCloser(strings.NewReader("test secondary\nexit\n"))
+	expect(nil, 0, "Secondary world!")
+}
+
+// TestExitCode ensures that ExitStatus and error pairs are mapped to the
+// documented exit codes.
+func TestExitCode(t *testing.T) {
+	expect := func(status ExitStatus, err error, code int) {
+		if res := ExitCode(status, err); res != code {
+			t.Errorf("ExitCode: got %d with ExitStatus %d and error %#v expected %d", res, status, err, code)
+		}
+	}
+
+	expect(ExitCmd, nil, 0)
+	expect(ExitUsage, nil, 2)
+	expect(ExitFailure, nil, 1)
+	expect(ExitShell, nil, 0)
+	expect(ExitAll, nil, 0)
+	expect(ExitCmd, &ErrNoCmd{}, 127)
+	expect(ExitCmd, &ErrAmbiguousCmd{}, 127)
+	expect(ExitCmd, &ErrParseFlags{}, 2)
+	expect(ExitCmd, &ErrParseArgs{}, 2)
+	expect(ExitCmd, &ErrInvalidFlag{}, 2)
+	expect(ExitUsage, &ErrRedirect{}, 1)
+}
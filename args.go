@@ -0,0 +1,253 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrParseArgs is returned from Command.Execute if the positional arguments
+// remaining after flags are parsed do not satisfy the command's Args.
+type ErrParseArgs struct {
+	Name string
+
+	// Arg is the name of the argument at fault, or blank if too many arguments
+	// were provided.
+	Arg string
+
+	// Value is the argument as provided in the input, or blank if it is
+	// missing.
+	Value string
+
+	// Reason is a short description of the problem.
+	Reason string
+}
+
+// Error implements the error interface for ErrParseArgs.
+func (err *ErrParseArgs) Error() string {
+	if err.Arg == "" {
+		return fmt.Sprintf("App.Execute: failed to parse arguments for '%s': %s", err.Name, err.Reason)
+	}
+
+	return fmt.Sprintf("App.Execute: failed to parse argument <%s> for '%s': %s", err.Arg, err.Name, err.Reason)
+}
+
+// ArgType is the type to which a positional argument is parsed.
+type ArgType int
+
+const (
+	// ArgString leaves the argument as is, such that its value is a string.
+	ArgString ArgType = iota
+
+	// ArgInt parses the argument as with strconv.Atoi, such that its value is
+	// an int.
+	ArgInt
+
+	// ArgFloat parses the argument as with strconv.ParseFloat, such that its
+	// value is a float64.
+	ArgFloat
+
+	// ArgBool parses the argument as with strconv.ParseBool, such that its
+	// value is a bool.
+	ArgBool
+
+	// ArgDuration parses the argument as with time.ParseDuration, such that
+	// its value is a time.Duration.
+	ArgDuration
+)
+
+// parse takes an argument and returns its value as the ArgType, or a short
+// description of the problem if it cannot be parsed.
+func (kind ArgType) parse(arg string) (interface{}, string) {
+	var value interface{}
+	var err error
+
+	switch kind {
+	case ArgInt:
+		value, err = strconv.Atoi(arg)
+		if err != nil {
+			return nil, "expected an integer"
+		}
+	case ArgFloat:
+		value, err = strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, "expected a number"
+		}
+	case ArgBool:
+		value, err = strconv.ParseBool(arg)
+		if err != nil {
+			return nil, "expected true or false"
+		}
+	case ArgDuration:
+		value, err = time.ParseDuration(arg)
+		if err != nil {
+			return nil, "expected a duration such as 1m30s"
+		}
+	default:
+		value = arg
+	}
+
+	return value, ""
+}
+
+// slice takes values parsed as the ArgType and returns them as a slice of the
+// corresponding type, such as []int for ArgInt.
+func (kind ArgType) slice(values []interface{}) interface{} {
+	switch kind {
+	case ArgInt:
+		res := make([]int, 0, len(values))
+		for _, value := range values {
+			res = append(res, value.(int))
+		}
+		return res
+	case ArgFloat:
+		res := make([]float64, 0, len(values))
+		for _, value := range values {
+			res = append(res, value.(float64))
+		}
+		return res
+	case ArgBool:
+		res := make([]bool, 0, len(values))
+		for _, value := range values {
+			res = append(res, value.(bool))
+		}
+		return res
+	case ArgDuration:
+		res := make([]time.Duration, 0, len(values))
+		for _, value := range values {
+			res = append(res, value.(time.Duration))
+		}
+		return res
+	default:
+		res := make([]string, 0, len(values))
+		for _, value := range values {
+			res = append(res, value.(string))
+		}
+		return res
+	}
+}
+
+// Arg describes a single positional argument of a Command.
+type Arg struct {
+	// Name is required and is used to fetch the value of the argument through
+	// Context.Arg. It is shown as <name> within usage.
+	Name string
+
+	// Required controls whether the argument must be provided. A required
+	// argument may not follow an optional one.
+	Required bool
+
+	// Repeatable controls whether the argument may be provided any number of
+	// times, in which case its value is a slice of the values of each. Only
+	// the last argument may be repeatable.
+	Repeatable bool
+
+	// Type is the type to which the argument is parsed, ArgString by default.
+	Type ArgType
+}
+
+// usage returns the argument as shown within usage: <name> if required or
+// [<name>] if not, with an ellipsis following the name if it is repeatable.
+func (arg Arg) usage() string {
+	str := "<" + arg.Name + ">"
+	if arg.Repeatable {
+		str += "..."
+	}
+
+	if !arg.Required {
+		str = "[" + str + "]"
+	}
+
+	return str
+}
+
+// validateArgs takes the Args of a command and returns an error if any has a
+// blank or duplicate name, if any but the last is repeatable, or if any
+// required argument follows an optional one.
+func validateArgs(name string, args []Arg) error {
+	seen := make(map[string]bool)
+	for key, arg := range args {
+		if arg.Name == "" {
+			return fmt.Errorf("App.AddCommand: argument %d of '%s' has a blank name", key+1, name)
+		}
+
+		if seen[arg.Name] {
+			return fmt.Errorf("App.AddCommand: argument '%s' of '%s' is defined more than once", arg.Name, name)
+		}
+		seen[arg.Name] = true
+
+		if arg.Repeatable && key != len(args)-1 {
+			return fmt.Errorf("App.AddCommand: repeatable argument '%s' of '%s' is not the last", arg.Name, name)
+		}
+
+		if arg.Required && key > 0 && !args[key-1].Required {
+			return fmt.Errorf("App.AddCommand: required argument '%s' of '%s' follows an optional argument",
+				arg.Name, name)
+		}
+	}
+
+	return nil
+}
+
+// getArgsUsage takes the Args of a command and returns them as shown within
+// usage, separated by spaces.
+func getArgsUsage(args []Arg) string {
+	list := make([]string, 0, len(args))
+	for _, arg := range args {
+		list = append(list, arg.usage())
+	}
+
+	return strings.Join(list, " ")
+}
+
+// parseArgs takes the positional arguments remaining after flags are parsed
+// and returns the value of each of the command's Args by name. Arguments
+// which are not provided are left out, while repeatable arguments always have
+// a slice as their value. An ErrParseArgs is returned if a required argument
+// is missing, if an argument cannot be parsed, or if too many are provided.
+func (cmd *Command) parseArgs(input []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	for _, arg := range cmd.Args {
+		if len(input) == 0 {
+			if arg.Required {
+				return nil, &ErrParseArgs{Name: cmd.Name, Arg: arg.Name, Reason: "missing required argument"}
+			}
+
+			if arg.Repeatable {
+				values[arg.Name] = arg.Type.slice(nil)
+			}
+
+			continue
+		}
+
+		count := 1
+		if arg.Repeatable {
+			count = len(input)
+		}
+
+		parsed := make([]interface{}, 0, count)
+		for _, item := range input[:count] {
+			value, reason := arg.Type.parse(item)
+			if reason != "" {
+				return nil, &ErrParseArgs{Name: cmd.Name, Arg: arg.Name, Value: item, Reason: reason}
+			}
+
+			parsed = append(parsed, value)
+		}
+
+		input = input[count:]
+		if arg.Repeatable {
+			values[arg.Name] = arg.Type.slice(parsed)
+		} else {
+			values[arg.Name] = parsed[0]
+		}
+	}
+
+	if len(input) > 0 {
+		return nil, &ErrParseArgs{Name: cmd.Name, Value: input[0], Reason: "too many arguments"}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TmplArgsCmd is used to ensure that positional arguments are checked and
+// parsed according to the Args of a command.
+var TmplArgsCmd = Command{
+	Name:  "repeat",
+	Usage: "${name} ${args}",
+	Args: []Arg{
+		{Name: "count", Required: true, Type: ArgInt},
+		{Name: "delay", Type: ArgDuration},
+		{Name: "word", Repeatable: true},
+	},
+	Main: func(ctx *Context) ExitStatus {
+		ctx.Printf("%v %v %q\n", ctx.Arg("count"), ctx.Arg("delay"), ctx.Arg("word"))
+		return ExitCmd
+	},
+}
+
+// TestArgs ensures that arguments are parsed into values accessible through
+// the Context and that invalid arguments return an ErrParseArgs.
+func TestArgs(t *testing.T) {
+	app := NewApp("TestArgs", false)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+
+	if err := app.AddCommand(TmplArgsCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	cmd, _ := app.GetByName("repeat")
+	if cmd.Usage != "repeat <count> [<delay>] [<word>...]" {
+		t.Errorf("Command.Usage: got '%s' with ${args}", cmd.Usage)
+	}
+
+	expect := func(input, res string) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err != nil {
+			t.Errorf("App.ExecuteString: got error with input '%s':\n%s", input, err)
+		} else if output.String() != res {
+			t.Errorf("App.ExecuteString: got output %q with input '%s' expected %q", output.String(), input, res)
+		}
+	}
+
+	expect("repeat 3", "3 <nil> []\n")
+	expect("repeat 3 1s", "3 1s []\n")
+	expect("repeat 3 1m30s a 'b c'", `3 1m30s ["a" "b c"]`+"\n")
+
+	expectErr := func(input string, expected ErrParseArgs) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err == nil {
+			t.Errorf("App.ExecuteString: expected error with input '%s'", input)
+		} else if val, ok := err.(*ErrParseArgs); !ok {
+			t.Errorf("App.ExecuteString: expected error of type *ErrParseArgs with input '%s':\n%s", input, err)
+		} else if !reflect.DeepEqual(*val, expected) {
+			t.Errorf("App.ExecuteString: got %#v with input '%s' expected %#v", *val, input, expected)
+		} else if !strings.Contains(output.String(), cmd.Usage) {
+			t.Errorf("App.ExecuteString: expected usage with input '%s' got output %q", input, output.String())
+		}
+	}
+
+	expectErr("repeat", ErrParseArgs{Name: "repeat", Arg: "count", Reason: "missing required argument"})
+	expectErr("repeat three", ErrParseArgs{Name: "repeat", Arg: "count", Value: "three", Reason: "expected an integer"})
+	expectErr("repeat 3 soon", ErrParseArgs{Name: "repeat", Arg: "delay", Value: "soon",
+		Reason: "expected a duration such as 1m30s"})
+
+	app.Commands[0].Args = app.Commands[0].Args[:2]
+	expectErr("repeat 3 1s extra", ErrParseArgs{Name: "repeat", Value: "extra", Reason: "too many arguments"})
+
+	MainInput(t, app, "invalid argument", "repeat 3 soon", "repeat: <delay>: expected a duration such as 1m30s, got 'soon'")
+}
+
+// TestArgTypes ensures that each ArgType is parsed to a value of the
+// documented type.
+func TestArgTypes(t *testing.T) {
+	expect := func(kind ArgType, arg string, value interface{}) {
+		if res, reason := kind.parse(arg); reason != "" {
+			t.Errorf("ArgType(%d).parse: got reason '%s' with '%s'", kind, reason, arg)
+		} else if !reflect.DeepEqual(res, value) {
+			t.Errorf("ArgType(%d).parse: got %#v with '%s' expected %#v", kind, res, arg, value)
+		}
+	}
+
+	expect(ArgString, "text", "text")
+	expect(ArgInt, "-12", -12)
+	expect(ArgFloat, "1.5", 1.5)
+	expect(ArgBool, "true", true)
+	expect(ArgDuration, "2m", 2*time.Minute)
+
+	if res := ArgFloat.slice([]interface{}{1.5, 2.0}); !reflect.DeepEqual(res, []float64{1.5, 2}) {
+		t.Errorf("ArgType.slice: got %#v expected []float64", res)
+	}
+}
+
+// TestInvalidArgs ensures that commands with invalid Args cannot be added.
+func TestInvalidArgs(t *testing.T) {
+	for _, args := range [][]Arg{
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Repeatable: true}, {Name: "b"}},
+		{{Name: "a"}, {Name: "b", Required: true}},
+	} {
+		app := NewApp("TestInvalidArgs", false)
+		if err := app.AddCommand(Command{Name: "cmd", Args: args, Main: blankMainFunc}); err == nil {
+			t.Errorf("App.AddCommand: expected error with Args %#v", args)
+		}
+	}
+}
@@ -1,14 +1,28 @@
 package shell
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
 )
 
+// redefinedFlag precedes the name of the flag within the message with which
+// flag.FlagSet panics when a flag is registered more than once.
+const redefinedFlag = "flag redefined: "
+
 // ErrParseFlags is returned from Command.Execute is the FlagSet fails to parse.
 type ErrParseFlags struct {
 	Name string
 	Err  error
+
+	// Suggestions holds the names of any flags, each preceded by '-', or '--'
+	// if the command parses its flags in the GNU style, which the undefined
+	// flag is likely a misspelling of, ordered from closest to furthest.
+	Suggestions []string
 }
 
 // Error implements the error interface for ErrParseFlags.
@@ -16,13 +30,57 @@ func (err *ErrParseFlags) Error() string {
 	return fmt.Sprintf("App.Execute: failed to parse flags for '%s':\n%s", err.Name, err.Err)
 }
 
+// ErrInvalidFlag is returned from Command.Execute if the flags parse but do
+// not satisfy the constraints set through the Context, such as when a
+// required flag is missing.
+type ErrInvalidFlag struct {
+	Name string
+
+	// Flag is the name of the flag at fault, without a leading '-'.
+	Flag string
+
+	// Prefix is the prefix with which the command accepts the flag: '--' if it
+	// parses its flags in the GNU style, otherwise '-'.
+	Prefix string
+
+	// Value is the value of the flag if it is not one of the allowed choices.
+	Value string
+
+	// Reason is a short description of the problem.
+	Reason string
+}
+
+// Error implements the error interface for ErrInvalidFlag.
+func (err *ErrInvalidFlag) Error() string {
+	return fmt.Sprintf("App.Execute: invalid flag %s%s for '%s': %s", err.Prefix, err.Flag, err.Name, err.Reason)
+}
+
+// ErrTimeout is returned from Command.Execute if the command runs for longer
+// than its timeout.
+type ErrTimeout struct {
+	Name string
+
+	// Timeout is the duration after which the command's context.Context was
+	// cancelled.
+	Timeout time.Duration
+}
+
+// Error implements the error interface for ErrTimeout.
+func (err *ErrTimeout) Error() string {
+	return fmt.Sprintf("App.Execute: command '%s' timed out after %s", err.Name, err.Timeout)
+}
+
 // Command is a top-level command within a shell App. It may contain an
-// arbitrary number of sub-command.
+// arbitrary number of sub-commands, each of which may contain its own.
 type Command struct {
 	// Name is required and should be as concise as possible. It may not
 	// contain any spaces.
 	Name string
 
+	// Aliases holds any number of alternative names by which the command may
+	// be called. As with Name, aliases may not contain any spaces.
+	Aliases []string
+
 	// Synopsis should contain a short description of the command. It usually
 	// should not be more than a single sentence.
 	Synopsis string
@@ -31,11 +89,12 @@ type Command struct {
 	// limitations to its length. Several sequences are substituted with
 	// information relating to the command when found within the usage string:
 	// `${name}` is substituted with the name of the command, ${fullName} with
-	// the full name of the command (including parent command name if the
-	// command is a sub-command), ${flags} with the help information for the
-	// command flags as described by/ flag.PrintDefaults, and ${shortFlags} for
+	// the full name of the command (including the names of all parent commands
+	// if the command is a sub-command), ${flags} with the help information for the
+	// command flags as described by/ flag.PrintDefaults, ${shortFlags} for
 	// a short list of all registered flags in the format of [-<flag name>] and
-	// separated with spaces.
+	// separated with spaces, and ${args} with the command's Args in the format
+	// of <name> or [<name>] and separated with spaces.
 	Usage string
 
 	// SetFlags should register any flags with the flag.FlagSet available
@@ -44,15 +103,64 @@ type Command struct {
 	// to the complete input string.
 	SetFlags func(*Context)
 
-	// Main is required and contains the command logic itself. If SetFlags
-	// exists, flags will be parsed immediately before Main is called and
-	// the results should be accessible via the Context.
+	// PersistentFlags may register flags in the same manner as SetFlags which
+	// are accepted not only by the command but also by all of its sub-commands
+	// at any depth. Such flags may appear before the name of a sub-command, as
+	// in "db -verbose migrate", and are parsed along with the flags of the
+	// sub-command, such that their values are accessible via its Context.
+	PersistentFlags func(*Context)
+
+	// Options may hold a pointer to a struct whose fields are registered as
+	// flags, as an alternative or in addition to SetFlags. Each exported field
+	// tagged with `flag:"name"` becomes a flag, with its default value and
+	// description taken from the `default:"value"` and `usage:"text"` tags, or
+	// from the field's value in Options if there is no default tag. Each time
+	// the command is executed a fresh copy of the struct is filled and made
+	// accessible via Context.Options, leaving Options untouched. Fields may be
+	// of type string, bool, int, int64, uint, uint64, float64, or
+	// time.Duration, or of any type whose pointer implements flag.Value, and
+	// may also be tagged with `short:"n"` to set a short name for GNUFlags,
+	// `choices:"a|b|c"` to restrict their values, or `required:"true"`.
+	Options interface{}
+
+	// Args describes the positional arguments which remain once flags are
+	// parsed. If not empty, the arguments are checked against it before Main
+	// is called and their values are accessible via Context.Arg. Otherwise,
+	// arguments are not checked and Main should check them itself.
+	Args []Arg
+
+	// GNUFlags controls whether flags are parsed in the GNU style rather than
+	// that of the flag package: long flags as --name or --name=value, short
+	// flags as set by Context.SetShortFlag as -n or combined as in -abc, flags
+	// anywhere among the positional arguments, and '--' ending the flags. The
+	// flags of every command are parsed in this style if the App's GNUFlags is
+	// set.
+	GNUFlags bool
+
+	// Main is required and contains the command logic itself. If SetFlags or
+	// Options exists, flags will be parsed immediately before Main is called
+	// and the results should be accessible via the Context.
 	Main func(*Context) ExitStatus
 
+	// Timeout is the duration after which the context.Context of the command,
+	// available through Context.Context, is cancelled. Main should return
+	// soon after, in which case an ErrTimeout is returned. If zero, the
+	// Timeout of the App is used, and if negative there is no timeout.
+	Timeout time.Duration
+
+	// Complete may provide candidates for completing the arguments of the
+	// command in the main loop. It is called with a Context which has already
+	// parsed the flags preceding the cursor, the remaining arguments preceding
+	// the cursor, and the partial word at the cursor. Completion for the value
+	// of individual flags may be set through Context.SetFlagCompletion within
+	// SetFlags. CompleteFiles and CompleteChoices may be used for common cases.
+	Complete CompleteFunc
+
 	// SubCommands should contain an arbitrary number of Commands. If the name
 	// of a valid sub-command directly follows the name of this command in some
 	// user input, the sub-command will be preferred over this Command.
-	// Otherwise, this Command will be executed.
+	// Otherwise, this Command will be executed. Sub-commands may be nested to
+	// any depth.
 	SubCommands []Command
 
 	// PreventDefaultSubCommands controls whether the sub-commands defined
@@ -70,15 +178,41 @@ type Command struct {
 }
 
 // FullName returns the full name of the command, checking if it has a parent
-// and if so prepending it to its own name.
+// and if so prepending the full name of the parent to its own name.
 func (cmd *Command) FullName() string {
 	if cmd.parent != nil {
-		return fmt.Sprintf("%s %s", cmd.parent.Name, cmd.Name)
+		return fmt.Sprintf("%s %s", cmd.parent.FullName(), cmd.Name)
 	}
 
 	return cmd.Name
 }
 
+// depth returns the number of parents above the command, which is 0 for a
+// top-level command.
+func (cmd *Command) depth() int {
+	depth := 0
+	for parent := cmd.parent; parent != nil; parent = parent.parent {
+		depth++
+	}
+
+	return depth
+}
+
+// timeout returns the Timeout of the command, or that of its App if zero. If
+// the command has no timeout, zero is returned.
+func (cmd *Command) timeout() time.Duration {
+	timeout := cmd.Timeout
+	if timeout == 0 && cmd.app != nil {
+		timeout = cmd.app.Timeout
+	}
+
+	if timeout < 0 {
+		return 0
+	}
+
+	return timeout
+}
+
 // NewContext returns an empty context prepared for this command.
 func (cmd *Command) NewContext() *Context {
 	flagSet := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
@@ -87,56 +221,396 @@ func (cmd *Command) NewContext() *Context {
 	return NewContext(cmd.app, cmd, flagSet, cmd.parent)
 }
 
+// hasFlags takes the App to which the command belongs and returns true if the
+// command registers any flags of its own through SetFlags, PersistentFlags,
+// or Options, or inherits any from its parents or the App's SetFlags.
+func (cmd *Command) hasFlags(app *App) bool {
+	for item := cmd; item != nil; item = item.parent {
+		if item.PersistentFlags != nil {
+			return true
+		}
+	}
+
+	return cmd.SetFlags != nil || cmd.Options != nil || (app != nil && app.SetFlags != nil)
+}
+
+// checkFlags registers all flags accepted by the command with a new Context as
+// with setFlags, such that AddCommand returns an error if any flag is
+// registered more than once or the Options cannot be bound.
+func (cmd *Command) checkFlags() error {
+	ctx := cmd.NewContext()
+	ctx.setStreams(ctx.Input(), ioutil.Discard, ioutil.Discard)
+
+	if err := cmd.setFlags(ctx); err != nil {
+		return fmt.Errorf("App.AddCommand: %s", err)
+	}
+
+	return nil
+}
+
+// catchRedefinedFlag must be deferred by functions which register flags. It
+// recovers from the panic with which the flag package reports a flag
+// registered more than once and stores an error naming the command and the
+// flag in err. Any other panic is passed on.
+func (cmd *Command) catchRedefinedFlag(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	msg, ok := recovered.(string)
+	index := strings.Index(msg, redefinedFlag)
+	if !ok || index == -1 {
+		panic(recovered)
+	}
+
+	*err = fmt.Errorf("(sub-)command '%s' redefines flag '%s'", cmd.Name, msg[index+len(redefinedFlag):])
+}
+
+// setFlags registers all flags accepted by the command with the FlagSet of the
+// Context: first those of the App's SetFlags and of the PersistentFlags of
+// each of its parents as with setInheritedFlags, followed by its own as with
+// setLocalFlags. An error is returned if the Options cannot be bound or if any
+// flag is registered more than once, such as when the command redefines a
+// flag of the App's SetFlags or of the PersistentFlags of one of its parents.
+func (cmd *Command) setFlags(ctx *Context) (err error) {
+	defer cmd.catchRedefinedFlag(&err)
+
+	// the flag package prints a message before panicking if a flag is redefined
+	output := ctx.FlagSet().Output()
+	ctx.FlagSet().SetOutput(ioutil.Discard)
+	defer ctx.FlagSet().SetOutput(output)
+
+	cmd.setInheritedFlags(ctx)
+	if err := cmd.setLocalFlags(ctx); err != nil {
+		return fmt.Errorf("invalid Options for (sub-)command '%s':\n%s", cmd.Name, err)
+	}
+
+	return nil
+}
+
+// setInheritedFlags registers the flags which the command inherits with the
+// FlagSet of the Context: those of the App's SetFlags, if any, followed by
+// those of the PersistentFlags of each of its parents from the top-level
+// command down.
+func (cmd *Command) setInheritedFlags(ctx *Context) {
+	if cmd.app != nil && cmd.app.SetFlags != nil {
+		cmd.app.SetFlags(ctx)
+	}
+
+	cmd.setParentFlags(ctx)
+}
+
+// setParentFlags registers the PersistentFlags of each of the command's
+// parents with the FlagSet of the Context, from the top-level command down.
+func (cmd *Command) setParentFlags(ctx *Context) {
+	parents := make([]*Command, 0)
+	for parent := cmd.parent; parent != nil; parent = parent.parent {
+		parents = append([]*Command{parent}, parents...)
+	}
+
+	for _, parent := range parents {
+		if parent.PersistentFlags != nil {
+			parent.PersistentFlags(ctx)
+		}
+	}
+}
+
+// setLocalFlags registers the command's own flags with the FlagSet of the
+// Context, calling PersistentFlags, if any, binding a fresh copy of its
+// Options, if any, and then calling SetFlags, if any. An error is returned if
+// the Options cannot be bound.
+func (cmd *Command) setLocalFlags(ctx *Context) error {
+	if cmd.PersistentFlags != nil {
+		cmd.PersistentFlags(ctx)
+	}
+
+	if cmd.Options != nil {
+		options, err := bindOptions(ctx, cmd.Options)
+		if err != nil {
+			return err
+		}
+
+		ctx.options = options
+	}
+
+	if cmd.SetFlags != nil {
+		cmd.SetFlags(ctx)
+	}
+
+	return nil
+}
+
+// names returns the name of the command followed by all of its aliases.
+func (cmd *Command) names() []string {
+	return append([]string{cmd.Name}, cmd.Aliases...)
+}
+
+// hasName returns true if the string is the name or one of the aliases of the
+// command.
+func (cmd *Command) hasName(name string) bool {
+	for _, item := range cmd.names() {
+		if name == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// abbreviations returns true if the command is part of an App which allows
+// abbreviations.
+func (cmd *Command) abbreviations() bool {
+	return cmd.app != nil && cmd.app.AllowAbbreviations
+}
+
+// findCommand takes a list of commands, a name, and whether prefixes are
+// allowed, and returns the command which the name calls for. A name calls for
+// a command if it is the name or one of the aliases of the command. Failing
+// that, if prefixes are allowed, it calls for the only command with a name or
+// alias which it is a prefix of. An ErrAmbiguousCmd is returned if several
+// commands have such a name. If no command matches, both results are nil.
+func findCommand(commands []*Command, name string, prefixes bool) (*Command, error) {
+	for _, cmd := range commands {
+		if cmd.hasName(name) {
+			return cmd, nil
+		}
+	}
+
+	if !prefixes || name == "" {
+		return nil, nil
+	}
+
+	var match *Command
+	candidates := make([]string, 0)
+	for _, cmd := range commands {
+		for _, item := range cmd.names() {
+			if strings.HasPrefix(item, name) {
+				match = cmd
+				candidates = append(candidates, cmd.Name)
+				break
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return match, nil
+	default:
+		sort.Strings(candidates)
+		return nil, &ErrAmbiguousCmd{Name: name, Candidates: candidates}
+	}
+}
+
 // GetSubCommand attempts to fetch a sub-command by name, returning a pointer
-// to the sub-command if successful and an error if it does not exist.
+// to the sub-command if successful and an error if it does not exist. Sub-
+// commands may also be fetched by any of their aliases or, if the App allows
+// abbreviations, by a prefix of either. If the prefix is shared by several
+// sub-commands an ErrAmbiguousCmd is returned.
 func (cmd *Command) GetSubCommand(name string) (*Command, error) {
-	for _, subCmd := range cmd.SubCommands {
-		if name == subCmd.Name {
-			return &subCmd, nil
-		}
+	subCommands := make([]*Command, len(cmd.SubCommands))
+	for key := range cmd.SubCommands {
+		subCommands[key] = &cmd.SubCommands[key]
+	}
+
+	subCmd, err := findCommand(subCommands, name, cmd.abbreviations())
+	if err != nil {
+		return nil, err
+	}
+
+	if subCmd == nil {
+		return nil, fmt.Errorf("Command.GetSubCommand: sub-command '%s' does not exist", name)
 	}
 
-	return nil, fmt.Errorf("Command.GetSubCommand: sub-command '%s' does not exist", name)
+	return subCmd, nil
 }
 
 // Match takes an array of strings, usually representing some user input
 // retrieved from the shell loop. If the input does not call for this command
-// an error is returned, otherwise Match checks if the input calls for a sub-
-// command, returning either it or this Command if no match is found.
+// an error is returned, otherwise Match walks the tree of sub-commands for as
+// long as each following string names a sub-command of the last, returning
+// the deepest Command found. The input calls for this command if it begins
+// with its name, one of its aliases, or, if the App allows abbreviations, a
+// prefix of either. Sub-commands are fetched as with GetSubCommand, and an
+// ErrAmbiguousCmd is returned if any string is an ambiguous prefix.
+//
+// Any flags preceding the name of a sub-command are skipped over so long as
+// they are accepted by the App's SetFlags or by the PersistentFlags of the
+// command found so far or any of its parents.
 func (cmd *Command) Match(input []string) (*Command, error) {
-	if input[0] == cmd.Name {
-		if len(cmd.SubCommands) > 0 && len(input) > 1 && input[1][1] != '-' {
-			if subCmd, err := cmd.GetSubCommand(input[1]); err == nil {
-				return subCmd, nil
-			}
+	match, _, err := cmd.match(input)
+	return match, err
+}
+
+// match does the same as Match but also returns the input to be passed to
+// Execute: the name by which the matched command was called, followed by any
+// flags which were skipped over, followed by the remaining input.
+func (cmd *Command) match(input []string) (*Command, []string, error) {
+	if matched, _ := findCommand([]*Command{cmd}, input[0], cmd.abbreviations()); matched == nil {
+		return nil, nil, fmt.Errorf("Command.Match: input does not match command '%s'", cmd.Name)
+	}
+
+	match, name := cmd, input[0]
+	flags := make([]string, 0)
+	rest := input[1:]
+
+	for len(match.SubCommands) > 0 {
+		remaining := match.skipFlags(rest)
+		if len(remaining) == 0 || strings.HasPrefix(remaining[0], "-") {
+			break
+		}
+
+		subCmd, err := match.GetSubCommand(remaining[0])
+		if ambiguous, ok := err.(*ErrAmbiguousCmd); ok {
+			return nil, nil, ambiguous
+		} else if err != nil {
+			break
+		}
+
+		flags = append(flags, rest[:len(rest)-len(remaining)]...)
+		match, name = subCmd, remaining[0]
+		rest = remaining[1:]
+	}
+
+	return match, append(append([]string{name}, flags...), rest...), nil
+}
+
+// skipFlags takes the input following the name of the command and returns the
+// input remaining after any leading flags which are accepted by the App's
+// SetFlags or by the PersistentFlags of the command or any of its parents. If
+// any leading flag is not accepted, or the flags end with '--', the input is
+// returned as is.
+func (cmd *Command) skipFlags(input []string) []string {
+	if len(input) == 0 || !strings.HasPrefix(input[0], "-") {
+		return input
+	}
+
+	ctx := NewContext(cmd.app, cmd, flag.NewFlagSet(cmd.Name, flag.ContinueOnError), cmd.parent)
+	ctx.setStreams(ctx.Input(), ioutil.Discard, ioutil.Discard)
+
+	var err error
+	func() {
+		defer cmd.catchRedefinedFlag(&err)
+
+		cmd.setInheritedFlags(ctx)
+		if cmd.PersistentFlags != nil {
+			cmd.PersistentFlags(ctx)
 		}
+	}()
+
+	if err != nil {
+		return input
+	}
+
+	if cmd.gnuFlags() {
+		err = parseGNU(ctx.FlagSet(), ctx.shortFlags, input, false)
+	} else {
+		err = ctx.FlagSet().Parse(input)
+	}
+
+	if err != nil {
+		return input
+	}
+
+	remaining := ctx.FlagSet().Args()
+	if skipped := len(input) - len(remaining); skipped > 0 && input[skipped-1] == "--" {
+		return input
+	}
+
+	return remaining
+}
 
-		return cmd, nil
+// help returns the Usage string of the command, or its name and Synopsis if it
+// has no Usage, as printed by the default help commands.
+func (cmd *Command) help() string {
+	if cmd.Usage == "" {
+		return fmt.Sprintf("%s\t\t%s", cmd.Name, cmd.Synopsis)
 	}
 
-	return nil, fmt.Errorf("Command.Match: input does not match command '%s'", cmd.Name)
+	return cmd.Usage
 }
 
 // Execute takes an array of strings, usually representing some user input
 // retrieved from the shell loop. It then executes this Command, first parsing
-// the input for flags. If an error occurs while parsing flags, it is returned.
+// the input for flags. If -h or --help is provided but not defined as a flag,
+// the Usage string is printed in place of the flag package's help and ExitCmd
+// is returned without an error or calling Main. If any other error occurs
+// while parsing flags, it is returned. If the flags do not satisfy the
+// constraints set through the Context, such as with Context.RequireFlag, an
+// ErrInvalidFlag is returned without calling Main. If the command has Args and
+// the remaining arguments do not satisfy them, the Usage string is printed and
+// an ErrParseArgs is returned without calling Main. In either case, or if Main
+// returns ExitUsage, an ErrNoCmd holding suggestions is returned instead if the
+// first argument closely resembles the name of a sub-command.
+// If the command has a timeout and Main returns after it has passed, an
+// ErrTimeout is returned along with the ExitStatus returned by Main.
 func (cmd *Command) Execute(input []string) (ExitStatus, error) {
-	ctx := cmd.NewContext()
+	return cmd.execute(cmd.NewContext(), input)
+}
 
-	// if SetFlags function has been set, call it
-	if cmd.SetFlags != nil {
-		cmd.SetFlags(ctx)
+// execute does the same as Execute but runs the Command with the Context
+// provided, allowing its input and output to be replaced beforehand.
+func (cmd *Command) execute(ctx *Context, input []string) (ExitStatus, error) {
+	if err := cmd.setFlags(ctx); err != nil {
+		return ExitCmd, fmt.Errorf("Command.Execute: %s", err)
+	}
+
+	// Parse flagSet, holding back its output in case help was requested
+	errOutput := &strings.Builder{}
+	ctx.FlagSet().SetOutput(errOutput)
+	err := ctx.parseFlags(input[1:])
+	ctx.FlagSet().SetOutput(ctx.ErrOutput())
+
+	if err == flag.ErrHelp {
+		ctx.Println(cmd.help())
+		return ExitCmd, nil
+	} else if err != nil {
+		fmt.Fprint(ctx.ErrOutput(), errOutput.String())
+		return ExitCmd, &ErrParseFlags{Name: cmd.Name, Err: err, Suggestions: suggestFlags(ctx.FlagSet(), cmd.flagPrefix(), err)}
 	}
 
-	// Parse flagSet
-	if err := ctx.FlagSet().Parse(input[1:]); err != nil {
-		return ExitCmd, &ErrParseFlags{Name: cmd.Name, Err: err}
+	if err := ctx.validateFlags(cmd.Name, cmd.flagPrefix()); err != nil {
+		return ExitCmd, err
+	}
+
+	if len(cmd.Args) > 0 {
+		args, err := cmd.parseArgs(ctx.FlagSet().Args())
+		if err != nil {
+			if typoErr := cmd.checkSubCommandTypo(ctx.FlagSet().Args()); typoErr != nil {
+				return ExitCmd, typoErr
+			}
+
+			fmt.Fprintln(ctx.ErrOutput(), cmd.Usage)
+			return ExitCmd, err
+		}
+
+		ctx.args = args
+	}
+
+	parent := ctx.Context()
+	timeout := cmd.timeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx.ctx, cancel = context.WithTimeout(parent, timeout)
+		defer cancel()
 	}
 
 	exitStatus := cmd.Main(ctx)
-	// if exitStatus is ExitUsage, print Usage string
+	// if exitStatus is ExitUsage, print Usage string unless the first argument
+	// is likely a misspelled sub-command
 	if exitStatus == ExitUsage {
-		cmd.app.Println(cmd.Usage)
+		if err := cmd.checkSubCommandTypo(ctx.FlagSet().Args()); err != nil {
+			return ExitCmd, err
+		}
+
+		fmt.Fprintln(ctx.ErrOutput(), cmd.Usage)
+	}
+
+	// if the timeout of this command rather than its parent has passed, return an error
+	if timeout > 0 && ctx.ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return exitStatus, &ErrTimeout{Name: cmd.Name, Timeout: timeout}
 	}
 
 	return exitStatus, nil
@@ -134,3 +134,42 @@ func TestExecute(t *testing.T) {
 		t.Error("Command.Execute: expected error of type *ErrParseFlags with invalid flags:\n", err)
 	}
 }
+
+// TestHelpFlag ensures that -h and --help print the Usage string of the
+// command in place of the flag package's help without returning an error.
+func TestHelpFlag(t *testing.T) {
+	for _, flag := range []string{"-h", "--help", "-help"} {
+		output.Reset()
+		if status, err := testCmd.Execute([]string{"test", flag}); err != nil {
+			t.Errorf("Command.Execute: got error with '%s':\n%s", flag, err)
+		} else if status != ExitCmd {
+			t.Errorf("Command.Execute: got ExitStatus '%d' with '%s' expected '%d'", status, flag, ExitCmd)
+		} else if res := output.String(); !strings.Contains(res, "Execute primary test command.") ||
+			strings.Contains(res, "Usage of") || strings.Contains(res, "Hello world!") {
+			t.Errorf("Command.Execute: expected only Usage with '%s', got:\n%s", flag, res)
+		}
+	}
+
+	output.Reset()
+	if _, err := testCmd.SubCommands[1].Execute([]string{"no-usage", "-h"}); err != nil {
+		t.Error("Command.Execute: got error with '-h' and no Usage:\n", err)
+	} else if res := output.String(); res != "no-usage\t\ta useless command with no usage\n" {
+		t.Errorf("Command.Execute: expected name and Synopsis with '-h' and no Usage, got %q", res)
+	}
+
+	output.Reset()
+	if _, err := testCmd.Execute([]string{"test", "-x"}); err == nil {
+		t.Error("Command.Execute: expected error with undefined flag")
+	} else if res := output.String(); !strings.Contains(res, "Usage of test") {
+		t.Errorf("Command.Execute: expected flag package's help with undefined flag, got:\n%s", res)
+	}
+
+	app := NewApp("TestHelpFlag", false)
+	app.GNUFlags = true
+	if err := app.AddCommand(TmplCmdWithSubCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	MainInput(t, app, "GNU-style help flag", "test --help", "test [--top]:", "--top int")
+	MainInput(t, app, "help flag for sub-command", "test secondary -h", "test secondary [--second]")
+}
@@ -0,0 +1,248 @@
+package shell
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// missingValue is the beginning of the error message returned by
+// flag.FlagSet.Parse or parseGNU when the input ends with a flag which
+// requires a value, followed by the flag with its leading '-' or '--'.
+const missingValue = "flag needs an argument: "
+
+// CompleteFunc takes a Context which has parsed the flags preceding the
+// cursor, the remaining arguments preceding the cursor, and the partial word
+// at the cursor, and returns candidates which the partial word may be
+// completed to. Candidates which do not begin with the partial word are
+// ignored, so need not be filtered out.
+type CompleteFunc func(ctx *Context, args []string, partial string) []string
+
+// CompleteFiles is a CompleteFunc which completes the partial word to the
+// paths of files and directories. Directories are followed by a path
+// separator so that their contents may be completed in turn. Hidden files are
+// only included if the partial word names one.
+func CompleteFiles(_ *Context, _ []string, partial string) []string {
+	dir, file := filepath.Split(partial)
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+
+	infos, err := ioutil.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	candidates := make([]string, 0)
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, file) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(file, ".")) {
+			continue
+		}
+
+		if info.IsDir() {
+			name += string(filepath.Separator)
+		}
+
+		candidates = append(candidates, dir+name)
+	}
+
+	return candidates
+}
+
+// CompleteChoices takes any number of choices and returns a CompleteFunc which
+// completes the partial word to any one of them.
+func CompleteChoices(choices ...string) CompleteFunc {
+	return func(_ *Context, _ []string, _ string) []string {
+		return append([]string{}, choices...)
+	}
+}
+
+// completer provides tab completion within the main loop and implements
+// readline.AutoCompleter. Candidates are found each time completion is
+// requested so that commands added after the loop starts are included.
+type completer struct {
+	app *App
+}
+
+// Do implements readline.AutoCompleter for completer. It takes the line and
+// the position of the cursor and returns the escaped remainder of each
+// candidate for the word before the cursor, along with the length of that
+// word as it appears on the line, including any quotes or escapes. Each
+// remainder is followed by a space unless the candidate is a directory.
+func (comp *completer) Do(line []rune, pos int) ([][]rune, int) {
+	partial, length, candidates := comp.app.complete(string(line[:pos]))
+
+	suffixes := make([][]rune, 0, len(candidates))
+	for _, item := range candidates {
+		suffix := escape(item[len(partial):])
+		if !strings.HasSuffix(item, string(filepath.Separator)) {
+			suffix += " "
+		}
+
+		suffixes = append(suffixes, []rune(suffix))
+	}
+
+	return suffixes, length
+}
+
+// escape returns the string with a backslash preceding each whitespace
+// character, quote, backslash, or character which begins an operator or
+// expansion, such that it would be read by the lexer outside of quotes as
+// part of a single word with exactly the same value.
+func escape(str string) string {
+	escaped := &strings.Builder{}
+	for _, char := range str {
+		if unicode.IsSpace(char) || strings.ContainsRune("|;&<>'\"\\$", char) {
+			escaped.WriteRune('\\')
+		}
+
+		escaped.WriteRune(char)
+	}
+
+	return escaped.String()
+}
+
+// complete takes some input, usually the line before the cursor, and returns
+// the value of the partial word at the end of the input and its length in
+// runes as it appears within the input, which differ if it is quoted or
+// escaped, along with a sorted list of the candidates which it may be
+// completed to. If the input ends with whitespace or an operator, the partial
+// word is empty. Only the command containing the partial word is considered,
+// after any alias it begins with is expanded. No candidates are returned if
+// the input cannot be parsed.
+func (app *App) complete(input string) (string, int, []string) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return "", 0, nil
+	}
+
+	partial, rawLength := "", 0
+	if length := len(tokens); length > 0 && tokens[length-1].kind == tokenWord && tokens[length-1].end == len(input) {
+		partial = tokens[length-1].value
+		rawLength = len([]rune(input[tokens[length-1].pos:]))
+		tokens = tokens[:length-1]
+	}
+
+	// only the command containing the partial word is of interest
+	for key := len(tokens) - 1; key >= 0; key-- {
+		if tokens[key].kind != tokenWord && !tokens[key].kind.isRedirect() {
+			tokens = tokens[key+1:]
+			break
+		}
+	}
+
+	// redirect targets are not completed
+	if length := len(tokens); length > 0 && tokens[length-1].kind.isRedirect() {
+		return partial, rawLength, nil
+	}
+
+	args := make([]string, 0, len(tokens))
+	tokens = app.expandAlias(tokens)
+	for key := 0; key < len(tokens); key++ {
+		if tokens[key].kind.isRedirect() {
+			key++ // Skip the redirect target
+			continue
+		}
+
+		args = append(args, tokens[key].value)
+	}
+
+	return partial, rawLength, filterCandidates(partial, app.completeArgs(args, partial))
+}
+
+// completeArgs takes the arguments preceding a partial word and the partial
+// word itself and returns the candidates which it may be completed to,
+// whether or not they begin with the partial word. The first argument is
+// completed to the name of any command or alias. The arguments following a
+// command are completed to its flags if the partial word begins with '-',
+// otherwise to the names of its sub-commands and the candidates returned by
+// its Complete function. If the partial word is the value of a flag, whether
+// following the flag or in the form -flag=value, it is completed as set by
+// Context.SetFlagCompletion.
+func (app *App) completeArgs(args []string, partial string) []string {
+	candidates := make([]string, 0)
+
+	if len(args) == 0 {
+		for _, cmd := range app.Commands {
+			candidates = append(candidates, cmd.names()...)
+		}
+
+		for alias := range app.Aliases() {
+			candidates = append(candidates, alias)
+		}
+
+		return candidates
+	}
+
+	cmd, _ := findCommand(app.Commands, args[0], app.AllowAbbreviations)
+	if cmd == nil {
+		return nil
+	}
+
+	cmd, args, err := cmd.match(args)
+	if err != nil {
+		return nil
+	}
+
+	// nothing should be printed while completing
+	ctx := cmd.NewContext()
+	ctx.setStreams(ctx.Input(), ioutil.Discard, ioutil.Discard)
+	if err := cmd.setFlags(ctx); err != nil {
+		return nil
+	}
+
+	// parse flags preceding the partial word, noting any missing its value
+	pending := ""
+	if err := ctx.parseFlags(args[1:]); err != nil && strings.HasPrefix(err.Error(), missingValue) {
+		pending = strings.TrimLeft(strings.TrimPrefix(err.Error(), missingValue), "-")
+	}
+
+	switch index := strings.IndexByte(partial, '='); {
+	case pending != "":
+		return ctx.completeFlag(pending, partial, "")
+	case strings.HasPrefix(partial, "-") && index != -1:
+		return ctx.completeFlag(strings.TrimLeft(partial[:index], "-"), partial[index+1:], partial[:index+1])
+	case strings.HasPrefix(partial, "-"):
+		ctx.FlagSet().VisitAll(func(item *flag.Flag) {
+			candidates = append(candidates, cmd.flagPrefix()+item.Name)
+		})
+
+		return candidates
+	}
+
+	// sub-commands may only directly follow the name of their parent and any flags
+	if len(cmd.skipFlags(args[1:])) == 0 {
+		for _, subCmd := range cmd.SubCommands {
+			candidates = append(candidates, subCmd.names()...)
+		}
+	}
+
+	if cmd.Complete != nil {
+		candidates = append(candidates, cmd.Complete(ctx, ctx.FlagSet().Args(), partial)...)
+	}
+
+	return candidates
+}
+
+// filterCandidates takes a partial word and a list of candidates and returns
+// a sorted list of the unique candidates which begin with the partial word.
+func filterCandidates(partial string, candidates []string) []string {
+	seen := make(map[string]bool)
+	filtered := make([]string, 0)
+
+	for _, item := range candidates {
+		if !seen[item] && strings.HasPrefix(item, partial) {
+			seen[item] = true
+			filtered = append(filtered, item)
+		}
+	}
+
+	sort.Strings(filtered)
+	return filtered
+}
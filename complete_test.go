@@ -0,0 +1,178 @@
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestComplete ensures that command names, sub-command names, and flags are
+// completed from the commands of the App, including those added later.
+func TestComplete(t *testing.T) {
+	app := NewApp("TestComplete", true)
+
+	if err := app.AddCommand(TmplCmdWithSubCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect := func(input, partial string, candidates ...string) {
+		resPartial, _, res := app.complete(input)
+		if resPartial != partial {
+			t.Errorf("App.complete: got partial word '%s' with input `%s` expected '%s'", resPartial, input, partial)
+		} else if (len(res) > 0 || len(candidates) > 0) && !reflect.DeepEqual(res, candidates) {
+			t.Errorf("App.complete: got %q with input `%s` expected %q", res, input, candidates)
+		}
+	}
+
+	expect("", "", "alias", "env", "exit", "fg", "help", "history", "jobs", "kill", "set", "source", "test", "unalias", "unset", "wait")
+	expect("s", "s", "set", "source")
+	expect("te", "te", "test")
+	expect("test ", "", "commands", "flags", "help", "no-usage", "secondary")
+	expect("test s", "s", "secondary")
+	expect("test -", "-", "-top")
+	expect("test secondary -", "-", "-second")
+	expect("test secondary ", "")
+	expect("test arg ", "")
+	expect("exit -s", "-s", "-shell-only")
+	expect("help | te", "te", "test")
+	expect("help && test se", "se", "secondary")
+	expect("test > te", "te")
+	expect("test > out se", "se", "secondary")
+	expect("nothing ", "")
+	expect("test 'unterminated", "")
+
+	if err := app.AddAlias("t", "test"); err != nil {
+		t.Fatal("App.AddAlias: got error:\n", err)
+	}
+
+	expect("t", "t", "t", "test")
+	expect("t se", "se", "secondary")
+
+	if err := app.AddCommand(Command{Name: "late", Aliases: []string{"later"}, Main: blankMainFunc}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect("la", "la", "late", "later")
+
+	comp := &completer{app: app}
+	if res, length := comp.Do([]rune("test se"), 7); length != 2 {
+		t.Errorf("completer.Do: got length %d expected 2", length)
+	} else if !reflect.DeepEqual(res, [][]rune{[]rune("condary ")}) {
+		t.Errorf("completer.Do: got %q expected 'condary '", res)
+	}
+
+	if res, length := comp.Do([]rune("test se and more"), 7); length != 2 || len(res) != 1 {
+		t.Errorf("completer.Do: got %q and length %d with cursor mid-line expected 'condary ' and 2", res, length)
+	}
+}
+
+// TestCompleteHooks ensures that the Complete function of a command and the
+// completions set for its flags are called with the expected arguments.
+func TestCompleteHooks(t *testing.T) {
+	app := NewApp("TestCompleteHooks", false)
+
+	if err := app.AddCommand(Command{
+		Name: "ssh",
+		SetFlags: func(ctx *Context) {
+			ctx.Set("user", ctx.FlagSet().String("user", "root", "user to log in as"))
+			ctx.FlagSet().Bool("v", false, "verbose")
+			ctx.FlagSet().Int("port", 22, "port to connect to")
+			ctx.SetFlagCompletion("user", CompleteChoices("admin", "alice", "bob"))
+		},
+		Main: blankMainFunc,
+		Complete: func(ctx *Context, args []string, partial string) []string {
+			// suggest hosts followed by the user as parsed from the flags
+			user := *ctx.MustGet("user").(*string)
+			if len(args) > 0 {
+				return []string{"cmd-" + strings.Join(args, "-")}
+			}
+
+			return []string{"host-" + user, "other-" + user, partial + "-self"}
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect := func(input string, candidates ...string) {
+		if _, _, res := app.complete(input); (len(res) > 0 || len(candidates) > 0) && !reflect.DeepEqual(res, candidates) {
+			t.Errorf("App.complete: got %q with input `%s` expected %q", res, input, candidates)
+		}
+	}
+
+	expect("ssh ", "-self", "host-root", "other-root")
+	expect("ssh h", "h-self", "host-root")
+	expect("ssh -user alice h", "h-self", "host-alice")
+	expect("ssh -v -user=bob o", "o-self", "other-bob")
+	expect("ssh -user ", "admin", "alice", "bob")
+	expect("ssh -user a", "admin", "alice")
+	expect("ssh -v -user=a", "-user=admin", "-user=alice")
+	expect("ssh -port ")
+	expect("ssh -port=")
+	expect("ssh host c", "cmd-host")
+	expect("ssh -", "-port", "-user", "-v")
+}
+
+// TestCompleteFiles ensures that file paths are completed relative to the
+// directory in the partial word.
+func TestCompleteFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCompleteFiles")
+	if err != nil {
+		t.Fatal("ioutil.TempDir: got error:\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"notes.txt", "new file.txt", ".hidden", filepath.Join("nested", "inner.txt")} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal("os.MkdirAll: got error:\n", err)
+		}
+
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal("ioutil.WriteFile: got error:\n", err)
+		}
+	}
+
+	expect := func(partial string, candidates ...string) {
+		res := filterCandidates(partial, CompleteFiles(nil, nil, partial))
+		if (len(res) > 0 || len(candidates) > 0) && !reflect.DeepEqual(res, candidates) {
+			t.Errorf("CompleteFiles: got %q with partial word '%s' expected %q", res, partial, candidates)
+		}
+	}
+
+	sep := string(filepath.Separator)
+	expect(dir+sep+"n", dir+sep+"nested"+sep, dir+sep+"new file.txt", dir+sep+"notes.txt")
+	expect(dir+sep+"ne", dir+sep+"nested"+sep, dir+sep+"new file.txt")
+	expect(dir+sep+".", dir+sep+".hidden")
+	expect(dir+sep+"nested"+sep, dir+sep+"nested"+sep+"inner.txt")
+	expect(dir + sep + "missing" + sep + "a")
+
+	app := NewApp("TestCompleteFiles", false)
+	if err := app.AddCommand(Command{Name: "cat", Main: blankMainFunc, Complete: CompleteFiles}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	comp := &completer{app: app}
+	line := []rune("cat " + dir + sep + "new")
+	if res, _ := comp.Do(line, len(line)); !reflect.DeepEqual(res, [][]rune{[]rune(`\ file.txt `)}) {
+		t.Errorf("completer.Do: got %q with file name containing a space expected '\\ file.txt '", res)
+	}
+
+	line = []rune("cat " + dir + sep + "nes")
+	if res, _ := comp.Do(line, len(line)); !reflect.DeepEqual(res, [][]rune{[]rune("ted" + sep)}) {
+		t.Errorf("completer.Do: got %q with directory expected 'ted%s'", res, sep)
+	}
+
+	// the length of a quoted or escaped partial word is that within the line
+	for _, word := range []string{`"` + dir + sep + `new fi"`, dir + sep + `new\ fi`} {
+		line = []rune("cat " + word)
+		res, length := comp.Do(line, len(line))
+		if !reflect.DeepEqual(res, [][]rune{[]rune("le.txt ")}) {
+			t.Errorf("completer.Do: got %q with partial word `%s` expected 'le.txt '", res, word)
+		} else if expected := len([]rune(word)); length != expected {
+			t.Errorf("completer.Do: got length %d with partial word `%s` expected %d", length, word, expected)
+		}
+	}
+}
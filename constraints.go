@@ -0,0 +1,111 @@
+package shell
+
+import (
+	"flag"
+	"strings"
+)
+
+// RequireFlag takes the names of any number of flags registered with the
+// FlagSet and requires that each is provided whenever the command is
+// executed, regardless of its default value. It should be called within
+// SetFlags after the flags are registered, and marks each as required within
+// the help information shown by ${flags}.
+func (context *Context) RequireFlag(names ...string) {
+	for _, name := range names {
+		context.requiredFlags = append(context.requiredFlags, name)
+		context.appendFlagUsage(name, "(required)")
+	}
+}
+
+// SetFlagChoices takes the name of a flag registered with the FlagSet and the
+// values which it is allowed, such that any other value provided is rejected.
+// It should be called within SetFlags after the flag is registered, and lists
+// the choices within the help information shown by ${flags}. Unless a
+// completion is set through SetFlagCompletion, the value of the flag is
+// completed to the choices.
+func (context *Context) SetFlagChoices(name string, choices ...string) {
+	if context.flagChoices == nil {
+		context.flagChoices = make(map[string][]string)
+	}
+
+	context.flagChoices[name] = choices
+	context.appendFlagUsage(name, "(one of: "+strings.Join(choices, ", ")+")")
+}
+
+// ExclusiveFlags takes the names of several flags registered with the FlagSet
+// of which at most one may be provided at once. It should be called within
+// SetFlags.
+func (context *Context) ExclusiveFlags(names ...string) {
+	context.exclusiveFlags = append(context.exclusiveFlags, names)
+}
+
+// appendFlagUsage appends a note to the usage of a flag registered with the
+// FlagSet, if it exists.
+func (context *Context) appendFlagUsage(name, note string) {
+	if item := context.flagSet.Lookup(name); item != nil {
+		if item.Usage != "" {
+			item.Usage += " "
+		}
+
+		item.Usage += note
+	}
+}
+
+// validateFlags checks the flags parsed by the FlagSet against the constraints
+// set through the Context and returns an ErrInvalidFlag naming the command,
+// with flags shown following the prefix provided, if a required flag was not
+// provided, if a flag with choices was provided with any other value, or if
+// several exclusive flags were provided.
+func (context *Context) validateFlags(name, prefix string) error {
+	provided := make(map[string]bool)
+	context.flagSet.Visit(func(item *flag.Flag) {
+		provided[item.Name] = true
+	})
+
+	for _, flagName := range context.requiredFlags {
+		if !provided[flagName] {
+			return &ErrInvalidFlag{Name: name, Flag: flagName, Prefix: prefix, Reason: "required flag not provided"}
+		}
+	}
+
+	// check the choices of provided flags in lexicographical order
+	var err error
+	context.flagSet.Visit(func(item *flag.Flag) {
+		choices, ok := context.flagChoices[item.Name]
+		if !ok || err != nil {
+			return
+		}
+
+		value := item.Value.String()
+		for _, choice := range choices {
+			if value == choice {
+				return
+			}
+		}
+
+		err = &ErrInvalidFlag{Name: name, Flag: item.Name, Prefix: prefix, Value: value,
+			Reason: "must be one of " + strings.Join(choices, ", ")}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, group := range context.exclusiveFlags {
+		first := ""
+		for _, flagName := range group {
+			if !provided[flagName] {
+				continue
+			}
+
+			if first != "" {
+				return &ErrInvalidFlag{Name: name, Flag: first, Prefix: prefix,
+					Reason: "cannot be used with " + prefix + flagName}
+			}
+
+			first = flagName
+		}
+	}
+
+	return nil
+}
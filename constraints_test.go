@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TmplConstraintsCmd is used to ensure that flags are checked against the
+// constraints set through the Context.
+var TmplConstraintsCmd = Command{
+	Name:  "release",
+	Usage: "${name} ${shortFlags}:\n\n${flags}",
+	Options: &struct {
+		Tag string `flag:"tag" required:"true" usage:"tag to release"`
+	}{},
+	SetFlags: func(ctx *Context) {
+		ctx.Set("env", ctx.FlagSet().String("env", "", "environment to release to"))
+		ctx.Set("all", ctx.FlagSet().Bool("all", false, "release every service"))
+		ctx.Set("id", ctx.FlagSet().String("id", "", "service to release"))
+		ctx.RequireFlag("env")
+		ctx.SetFlagChoices("env", "dev", "staging", "prod")
+		ctx.ExclusiveFlags("all", "id")
+	},
+	Main: func(ctx *Context) ExitStatus {
+		ctx.Println(*ctx.MustGet("env").(*string))
+		return ExitCmd
+	},
+}
+
+// TestFlagConstraints ensures that required flags, flag choices, and exclusive
+// flags are enforced before Main is called and described within usage.
+func TestFlagConstraints(t *testing.T) {
+	app := NewApp("TestFlagConstraints", false)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+
+	if err := app.AddCommand(TmplConstraintsCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	cmd, _ := app.GetByName("release")
+	for _, str := range []string{"environment to release to (required) (one of: dev, staging, prod)",
+		"tag to release (required)"} {
+		if !strings.Contains(cmd.Usage, str) {
+			t.Errorf("Command.Usage: expected '%s' with ${flags} got:\n%s", str, cmd.Usage)
+		}
+	}
+
+	output.Reset()
+	if _, err := app.ExecuteString("release -tag v1 -env staging -id api"); err != nil {
+		t.Error("App.ExecuteString: got error with valid flags:\n", err)
+	} else if res := output.String(); res != "staging\n" {
+		t.Errorf("App.ExecuteString: got output %q with valid flags", res)
+	}
+
+	expect := func(input string, expected ErrInvalidFlag) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err == nil {
+			t.Errorf("App.ExecuteString: expected error with input '%s'", input)
+		} else if val, ok := err.(*ErrInvalidFlag); !ok {
+			t.Errorf("App.ExecuteString: expected error of type *ErrInvalidFlag with input '%s':\n%s", input, err)
+		} else if !reflect.DeepEqual(*val, expected) {
+			t.Errorf("App.ExecuteString: got %#v with input '%s' expected %#v", *val, input, expected)
+		} else if output.Len() > 0 {
+			t.Errorf("App.ExecuteString: expected Main not to run with input '%s' got output %q", input, output.String())
+		}
+	}
+
+	expect("release -tag v1", ErrInvalidFlag{Name: "release", Prefix: "-", Flag: "env", Reason: "required flag not provided"})
+	expect("release -env dev", ErrInvalidFlag{Name: "release", Prefix: "-", Flag: "tag", Reason: "required flag not provided"})
+	expect("release -tag v1 -env qa", ErrInvalidFlag{Name: "release", Prefix: "-", Flag: "env", Value: "qa",
+		Reason: "must be one of dev, staging, prod"})
+	expect("release -tag v1 -env prod -id api -all", ErrInvalidFlag{Name: "release", Prefix: "-", Flag: "all",
+		Reason: "cannot be used with -id"})
+
+	MainInput(t, app, "invalid flag", "release -tag v1 -env qa",
+		"release: -env: must be one of dev, staging, prod, got 'qa'")
+
+	if _, _, res := app.complete("release -env s"); !reflect.DeepEqual(res, []string{"staging"}) {
+		t.Errorf("App.complete: got %q for flag with choices expected 'staging'", res)
+	}
+
+	// flags are shown as they are provided when parsed in the GNU style
+	app.GNUFlags = true
+	expect("release --tag v1 --env prod --id api --all", ErrInvalidFlag{Name: "release", Prefix: "--", Flag: "all",
+		Reason: "cannot be used with --id"})
+	MainInput(t, app, "invalid GNU-style flag", "release --tag v1",
+		"release: --env: required flag not provided")
+
+	err := &ErrInvalidFlag{Name: "release", Prefix: "--", Flag: "env", Reason: "required flag not provided"}
+	if res := err.Error(); !strings.Contains(res, "invalid flag --env for 'release'") {
+		t.Errorf("ErrInvalidFlag.Error: got '%s' expected flag shown as --env", res)
+	}
+}
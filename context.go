@@ -1,8 +1,12 @@
 package shell
 
 import (
+	stdcontext "context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
 )
 
 // Context is a type that is passed to each handler when a Command is executed
@@ -27,17 +31,76 @@ type Context struct {
 	// values must be initialized as a slice and is used to perform CRUD
 	// operations on data passed through the Context.
 	values map[string]interface{}
+
+	// input is the reader from which the command should read its input.
+	input io.Reader
+
+	// output is the destination for general messages emitted by the command.
+	output io.Writer
+
+	// errOutput is the destination for usage and error messages emitted by the
+	// command.
+	errOutput io.Writer
+
+	// ctx is the context.Context of the command. If nil, Context returns
+	// context.Background.
+	ctx stdcontext.Context
+
+	// flagCompletions maps the names of flags to the functions which complete
+	// their values.
+	flagCompletions map[string]CompleteFunc
+
+	// args maps the names of the command's Args to their parsed values.
+	args map[string]interface{}
+
+	// options is the copy of the command's Options bound to the FlagSet.
+	options interface{}
+
+	// shortFlags maps the short names of flags to their full names.
+	shortFlags map[string]string
+
+	// requiredFlags holds the names of flags which must be provided.
+	requiredFlags []string
+
+	// flagChoices maps the names of flags to the values which they allow.
+	flagChoices map[string][]string
+
+	// exclusiveFlags holds groups of flags of which at most one may be
+	// provided.
+	exclusiveFlags [][]string
 }
 
 // NewContext creates a new context given an App, a Command, a flag.FlagSet,
-// and optionally a parent Command.
+// and optionally a parent Command. The Context's Output and ErrOutput default
+// to those of the App, while its Input defaults to an empty reader.
 func NewContext(app *App, command *Command, flagSet *flag.FlagSet, parent *Command) *Context {
-	return &Context{
-		app:     app,
-		command: command,
-		flagSet: flagSet,
-		parent:  parent,
-		values:  make(map[string]interface{}),
+	context := &Context{
+		app:       app,
+		command:   command,
+		flagSet:   flagSet,
+		parent:    parent,
+		values:    make(map[string]interface{}),
+		input:     strings.NewReader(""),
+		output:    ioutil.Discard,
+		errOutput: ioutil.Discard,
+	}
+
+	if app != nil {
+		context.setStreams(context.input, app.Output, app.ErrOutput)
+	}
+
+	return context
+}
+
+// setStreams replaces the input, output, and error output of the Context. If
+// a flag.FlagSet exists, its output is updated to match.
+func (context *Context) setStreams(input io.Reader, output, errOutput io.Writer) {
+	context.input = input
+	context.output = output
+	context.errOutput = errOutput
+
+	if context.flagSet != nil {
+		context.flagSet.SetOutput(errOutput)
 	}
 }
 
@@ -65,6 +128,123 @@ func (context *Context) Parent() *Command {
 	return context.parent
 }
 
+// SetFlagCompletion takes the name of a flag and a CompleteFunc which is used
+// to complete the value of the flag in the main loop. It should be called
+// within SetFlags. The CompleteFunc receives the arguments following the
+// flags which have already been parsed, if any, and the partial value.
+func (context *Context) SetFlagCompletion(name string, complete CompleteFunc) {
+	if context.flagCompletions == nil {
+		context.flagCompletions = make(map[string]CompleteFunc)
+	}
+
+	context.flagCompletions[name] = complete
+}
+
+// completeFlag takes the name of a flag, a partial value, and a prefix and
+// returns the candidates for the value of the flag, each preceded by the
+// prefix. If no completion is set for the flag its choices are returned, if
+// any, otherwise nil is returned.
+func (context *Context) completeFlag(name, partial, prefix string) []string {
+	complete := context.flagCompletions[name]
+	if complete == nil {
+		if choices, ok := context.flagChoices[name]; ok {
+			complete = CompleteChoices(choices...)
+		} else {
+			return nil
+		}
+	}
+
+	candidates := complete(context, context.flagSet.Args(), partial)
+	for key := range candidates {
+		candidates[key] = prefix + candidates[key]
+	}
+
+	return candidates
+}
+
+// Context returns the context.Context of the command. When the command is run
+// by App.Main it is cancelled if the user presses Ctrl-C or App.Interrupt is
+// called, and commands which may run for some time should stop once it is.
+// Otherwise, it is the context.Context passed to App.ExecuteContext or one
+// which is never cancelled.
+func (context *Context) Context() stdcontext.Context {
+	if context.ctx == nil {
+		return stdcontext.Background()
+	}
+
+	return context.ctx
+}
+
+// Input returns the reader from which the command should read its input. When
+// the command is part of a pipeline this is the output of the previous command.
+func (context *Context) Input() io.Reader {
+	return context.input
+}
+
+// Output returns the destination for general messages emitted by the command.
+// When the command is part of a pipeline this is the input of the next command.
+func (context *Context) Output() io.Writer {
+	return context.output
+}
+
+// ErrOutput returns the destination for usage and error messages emitted by
+// the command.
+func (context *Context) ErrOutput() io.Writer {
+	return context.errOutput
+}
+
+// Print prints to the Context's Output. Arguments are handled in the manner of
+// fmt.Print.
+func (context *Context) Print(a ...interface{}) {
+	fmt.Fprint(context.output, a...)
+}
+
+// Printf prints to the Context's Output. Arguments are handled in the manner
+// of fmt.Printf.
+func (context *Context) Printf(format string, a ...interface{}) {
+	fmt.Fprintf(context.output, format, a...)
+}
+
+// Println prints to the Context's Output. Arguments are handled in the manner
+// of fmt.Println.
+func (context *Context) Println(a ...interface{}) {
+	fmt.Fprintln(context.output, a...)
+}
+
+// Variable takes a name and returns the value of the App variable by that
+// name and whether it exists.
+func (context *Context) Variable(name string) (string, bool) {
+	return context.app.Variable(name)
+}
+
+// SetVariable takes a name and a value and sets the App variable by that name.
+// An error is returned if the name is invalid.
+func (context *Context) SetVariable(name, value string) error {
+	return context.app.SetVariable(name, value)
+}
+
+// UnsetVariable takes a name and removes the App variable by that name.
+func (context *Context) UnsetVariable(name string) {
+	context.app.UnsetVariable(name)
+}
+
+// Arg takes the name of one of the command's Args and returns its parsed
+// value, or nil if it was not provided. The value is a string, int, float64,
+// bool, or time.Duration according to the ArgType of the argument, or a slice
+// of the same if the argument is repeatable.
+func (context *Context) Arg(name string) interface{} {
+	return context.args[name]
+}
+
+// Options returns a pointer to the copy of the command's Options whose fields
+// are filled by parsing flags, or nil if the command has no Options. It is of
+// the same type as Options, such that it may be accessed as in:
+//
+//	options := ctx.Options().(*deployOptions)
+func (context *Context) Options() interface{} {
+	return context.options
+}
+
 // Get takes a string and returns its value or an error if the key does not
 // exist.
 func (context *Context) Get(name string) (interface{}, error) {
@@ -3,6 +3,7 @@ package shell
 import (
 	"errors"
 	"flag"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -108,3 +109,36 @@ func TestContextStore(t *testing.T) {
 		t.Errorf("Context.Delete: got '%v' after delete expected 'nil'", res)
 	}
 }
+
+// TestContextStreams ensures that a Context's streams default to those of the
+// App and that its printing methods write to its Output.
+func TestContextStreams(t *testing.T) {
+	output := &strings.Builder{}
+	errOutput := &strings.Builder{}
+	ctx := NewContext(&App{Output: output, ErrOutput: errOutput}, &Command{Name: "streams"},
+		flag.NewFlagSet("TestContextStreams", flag.ContinueOnError), nil)
+
+	if ctx.Output() != output {
+		t.Error("Context.Output: expected default of App.Output")
+	}
+
+	if ctx.ErrOutput() != errOutput {
+		t.Error("Context.ErrOutput: expected default of App.ErrOutput")
+	}
+
+	if data, err := ioutil.ReadAll(ctx.Input()); err != nil || len(data) != 0 {
+		t.Errorf("Context.Input: expected empty reader got '%s' and error: %v", data, err)
+	}
+
+	ctx.Print("Hello from Print!\n")
+	ctx.Printf("Hello from %s!\n", "Printf")
+	ctx.Println("Hello from Println!")
+
+	if res := output.String(); res != "Hello from Print!\nHello from Printf!\nHello from Println!\n" {
+		t.Errorf("Context.Print[f|ln]: got output '%s'", res)
+	}
+
+	if errOutput.Len() != 0 {
+		t.Errorf("Context.Print[f|ln]: expected no error output got '%s'", errOutput)
+	}
+}
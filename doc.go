@@ -22,7 +22,7 @@ Create a new app and add a command:
 			ctx.Set("top", ctx.FlagSet().Int("top", 12, "example top-level flag"))
 		},
 		Main: func(ctx *shell.Context) shell.ExitStatus {
-			ctx.App().Println("Hello world!", *ctx.MustGet("top").(*int))
+			ctx.Println("Hello world!", *ctx.MustGet("top").(*int))
 			return ExitCmd
 		},
 		SubCommands: []Command{
@@ -32,7 +32,7 @@ Create a new app and add a command:
 					ctx.Set("second", ctx.FlagSet().Int("second", 21, "example second-level flag"))
 				},
 				Main: func(ctx *Context) ExitStatus {
-					ctx.App().Println("Hello world from a sub-command!")
+					ctx.Println("Hello world from a sub-command!")
 					return ExitCmd
 				},
 			},
@@ -43,6 +43,86 @@ Start the main loop:
 
 	app.Main()
 
-And you're all set!
+And you're all set! To act as a regular command-line program when arguments
+are provided and only start the main loop when none are, use Run instead:
+
+	os.Exit(app.Run(os.Args[1:]))
+
+Alternatively, run a file of commands without a terminal:
+
+	file, _ := os.Open("commands.txt")
+	app.ExecuteScript(file)
+
+Syntax
+
+Input is split into arguments at whitespace. Quotes and backslashes may be
+used to include whitespace or special characters within an argument:
+
+	note add "buy milk" 'and "eggs"' and\ bread
+
+Commands may be connected with '|', in which case they are run concurrently
+and the output of each is passed to the next as input. Commands should
+therefore print via the Context rather than the App and read from
+Context.Input:
+
+	list users | filter active | count
+
+Pipelines may be separated by ';' to run them one after another, by '&&' to
+run the second only if the first succeeds, or by '||' to run the second only
+if the first fails:
+
+	sync && echo done || echo failed
+
+The output of a command may be written to a file with '>' to replace its
+contents or '>>' to append to it, its error output with '2>', and its input
+may be read from a file with '<':
+
+	report monthly < params.txt > report.txt 2> errors.txt
+
+Ending a pipeline with '&' runs it in the background as a job, whose output is
+held until it is brought to the foreground with fg, waited for with wait, or
+finishes and is announced before the next prompt. Running jobs are listed by
+jobs and may be stopped with kill:
+
+	sync &
+	jobs
+	fg %1
+
+Variables
+
+Variables are stored on the App and managed with the default set, unset, and
+env commands, through App.SetVariable and friends, or from within a command
+through the Context. Outside of single quotes, $NAME and ${NAME} are replaced
+with the value of the variable immediately before each pipeline is run:
+
+	set host=db01
+	ping $host && ssh ${host}
+
+The environment of the process is not visible unless App.ImportEnv is called.
+
+Similarly, $(input) is replaced with the output of running input as a
+command, split into several arguments unless it is within double quotes:
+
+	ping $(lookup primary)
+
+Aliases
+
+Aliases may be defined with the default alias command or App.AddAlias. When
+the name of an alias is found unquoted as the first word of a command, it is
+replaced by the value of the alias:
+
+	alias ll="list --long"
+	ll users
+
+History
+
+Each line read by App.Main is added to the history, which may be kept between
+sessions by setting App.HistoryFile. Outside of single quotes, !! is replaced
+with the previous line, !n with line n as listed by the default history
+command, and !prefix with the most recent line beginning with prefix:
+
+	ping db01
+	!!
+	!pi
 */
 package shell
@@ -0,0 +1,498 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// stage is a single command invocation within a pipeline.
+type stage struct {
+	// command is the Command to be executed.
+	command *Command
+
+	// args is the input passed to Command.Execute, beginning with the name of
+	// the command.
+	args []string
+
+	// ctx is the context.Context of the command. If nil, context.Background
+	// is used.
+	ctx context.Context
+
+	// redirects holds any redirections of the stage's streams in the order in
+	// which they appear.
+	redirects []redirect
+
+	// input, output, and errOutput replace the streams of the stage if it has
+	// been opened and they are not nil.
+	input     io.Reader
+	output    io.Writer
+	errOutput io.Writer
+
+	// files holds all files opened for the stage.
+	files []*os.File
+}
+
+// redirect is a single redirection of a stage's input, output, or error
+// output to a file.
+type redirect struct {
+	// op is the kind of the redirection operator.
+	op tokenKind
+
+	// operator is the text of the redirection operator.
+	operator string
+
+	// path is the name of the file.
+	path string
+}
+
+// pipeline is a list of stages which are run concurrently and connected such
+// that the output of each stage is the input of the next.
+type pipeline struct {
+	stages []*stage
+}
+
+// syncWriter wraps an io.Writer so that it may be safely shared between
+// concurrently running stages.
+type syncWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// Write implements the io.Writer interface for syncWriter.
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(p)
+}
+
+// match takes the arguments of a single command invocation and returns the
+// Command they call along with the input to be passed to Command.Execute. If
+// no matching command exists an ErrNoCmd is returned, and if any command is
+// called by an ambiguous prefix an ErrAmbiguousCmd is returned.
+func (app *App) match(args []string) (*Command, []string, error) {
+	cmd, err := findCommand(app.Commands, args[0], app.AllowAbbreviations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cmd == nil {
+		return nil, nil, &ErrNoCmd{Name: args[0], Suggestions: app.suggestCommands(args[0])}
+	}
+
+	return cmd.match(args)
+}
+
+// link is a single pipeline within a chain of pipelines separated by ';',
+// '&', '&&', or '||'.
+type link struct {
+	// op is the operator preceding the pipeline and controls whether it is
+	// run. The first link in a chain always has an op of tokenSequence, as
+	// does any link following a '&'.
+	op tokenKind
+
+	// background is true if the pipeline belongs to a list ended by '&',
+	// which is run as a job. Such a list begins with a link with an op of
+	// tokenSequence and continues until the next.
+	background bool
+
+	// stages holds the tokens of each stage of the pipeline.
+	stages [][]token
+}
+
+// parseChain takes the original input and the tokens produced from it and
+// splits them into a chain of links. Each '&' marks the links since the last
+// ';' or '&' as belonging to a job. An ErrParseInput is returned if any
+// pipeline or stage is empty, with the exception of a trailing ';' or '&', or
+// if a redirection is not followed by a file name.
+func parseChain(input string, tokens []token) ([]*link, error) {
+	links := make([]*link, 0)
+	current := &link{op: tokenSequence}
+	start, listStart := 0, 0
+
+	for key := 0; key <= len(tokens); key++ {
+		if key < len(tokens) && (tokens[key].kind == tokenWord || tokens[key].kind.isRedirect()) {
+			continue
+		}
+
+		if key == start {
+			// a trailing ';' or '&' is permitted
+			if key == len(tokens) && key > 0 && (tokens[key-1].kind == tokenSequence ||
+				tokens[key-1].kind == tokenBackground) {
+				break
+			}
+
+			// report the position of the operator surrounding the empty stage
+			pos := 0
+			if key < len(tokens) {
+				pos = tokens[key].pos
+			} else if key > 0 {
+				pos = tokens[key-1].pos
+			}
+
+			return nil, &ErrParseInput{Input: input, Position: pos, Reason: "missing command"}
+		}
+
+		if err := validateStage(input, tokens[start:key]); err != nil {
+			return nil, err
+		}
+
+		current.stages = append(current.stages, tokens[start:key])
+		start = key + 1
+
+		if key == len(tokens) {
+			links = append(links, current)
+		} else if tokens[key].kind != tokenPipe {
+			links = append(links, current)
+			current = &link{op: tokens[key].kind}
+		}
+
+		switch {
+		case key == len(tokens):
+		case tokens[key].kind == tokenBackground:
+			for _, item := range links[listStart:] {
+				item.background = true
+			}
+
+			current.op = tokenSequence
+			listStart = len(links)
+		case tokens[key].kind == tokenSequence:
+			listStart = len(links)
+		}
+	}
+
+	return links, nil
+}
+
+// validateStage takes the original input and the tokens of a single stage and
+// returns an ErrParseInput if any redirection is not followed by a file name
+// or if the stage contains nothing but redirections.
+func validateStage(input string, tokens []token) error {
+	words := 0
+	for key := 0; key < len(tokens); key++ {
+		if tok := tokens[key]; tok.kind.isRedirect() {
+			if key+1 >= len(tokens) || tokens[key+1].kind != tokenWord {
+				return &ErrParseInput{Input: input, Position: tok.pos,
+					Reason: "missing file name after '" + tok.value + "'"}
+			}
+
+			key++ // Skip file name
+			continue
+		}
+
+		words++
+	}
+
+	if words == 0 {
+		return &ErrParseInput{Input: input, Position: tokens[0].pos, Reason: "missing command"}
+	}
+
+	return nil
+}
+
+// expansion implements expander for an App, running command substitutions
+// with a context.Context such that they are cancelled along with the command
+// containing them.
+type expansion struct {
+	app *App
+	ctx context.Context
+}
+
+// lookupVariable implements expander for expansion.
+func (exp *expansion) lookupVariable(name string) string {
+	return exp.app.lookupVariable(name)
+}
+
+// substituteCommand executes the input provided as with ExecuteContext and
+// returns the output of the last command in each pipeline rather than writing
+// it to the App's Output. It is used to expand command substitutions within
+// user input. An ErrSubstitution is returned if the input returns an error or
+// an ExitStatus other than ExitCmd.
+func (exp *expansion) substituteCommand(input string) (string, error) {
+	output := &strings.Builder{}
+	if status, err := exp.app.execute(exp.ctx, input, output, exp.app.ErrOutput, nil); err != nil || status != ExitCmd {
+		return "", &ErrSubstitution{Input: input, Status: status, Err: err}
+	}
+
+	return output.String(), nil
+}
+
+// expandStage takes the tokens of a single stage which has already been
+// validated, expands any variables and command substitutions within them, and
+// separates its words from its redirections. Command substitutions are run
+// with the context.Context provided. An ErrRedirect is returned if the file
+// name of any redirection does not expand to exactly one word.
+func (app *App) expandStage(ctx context.Context, tokens []token) ([]string, []redirect, error) {
+	exp := &expansion{app: app, ctx: ctx}
+
+	words := make([]string, 0, len(tokens))
+	redirects := make([]redirect, 0)
+
+	for key := 0; key < len(tokens); key++ {
+		tok := tokens[key]
+		if tok.kind.isRedirect() {
+			key++ // Move to file name
+			fields, err := expandWord(tokens[key], exp)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if len(fields) != 1 {
+				return nil, nil, &ErrRedirect{Op: tok.value, Path: tokens[key].value,
+					Err: errors.New("ambiguous redirect")}
+			}
+
+			redirects = append(redirects, redirect{op: tok.kind, operator: tok.value, path: fields[0]})
+			continue
+		}
+
+		fields, err := expandWord(tok, exp)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		words = append(words, fields...)
+	}
+
+	return words, redirects, nil
+}
+
+// parsePipeline takes a context.Context and the tokens of each stage of a
+// pipeline and returns a pipeline of the commands which they call, each to be
+// run with the context.Context. Any aliases are expanded, followed by any
+// variables and command substitutions. An ErrNoCmd is returned if any stage
+// does not call a valid command and an ErrParseInput if any stage expands to
+// nothing.
+func (app *App) parsePipeline(ctx context.Context, stages [][]token) (*pipeline, error) {
+	line := &pipeline{}
+
+	for _, tokens := range stages {
+		words, redirects, err := app.expandStage(ctx, app.expandAlias(tokens))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(words) == 0 {
+			return nil, &ErrParseInput{Input: tokens[0].input, Position: tokens[0].pos, Reason: "missing command"}
+		}
+
+		cmd, args, err := app.match(words)
+		if err != nil {
+			return nil, err
+		}
+
+		line.stages = append(line.stages, &stage{command: cmd, args: args, ctx: ctx, redirects: redirects})
+	}
+
+	return line, nil
+}
+
+// runChain runs each link of a chain in order, skipping those whose operator
+// does not permit them to run. A link preceded by '&&' is run only if the
+// last pipeline to run returned ExitCmd and no error, while a link preceded by
+// '||' is run only if it did not. If a pipeline returns ExitShell or ExitAll,
+// no further links are run. The ExitStatus and error of the last pipeline to
+// run are returned, while errors from any earlier pipelines are passed to
+// report, or printed to errOutput if report is nil. The output of the last
+// command in each pipeline is written to output, and their error output to
+// errOutput. Each command is run with
+// the context.Context provided, and once it is cancelled no further links are
+// run and its error is returned.
+//
+// Links which belong to a job are instead started in the background as with
+// startJob, after which the chain continues as if they returned ExitCmd.
+func (app *App) runChain(ctx context.Context, links []*link, output, errOutput io.Writer,
+	report func(error)) (ExitStatus, error) {
+	var status ExitStatus
+	var err error
+
+	if report == nil {
+		report = func(err error) {
+			app.printError(errOutput, err)
+		}
+	}
+
+	for key := 0; key < len(links); key++ {
+		item := links[key]
+		if ctx.Err() != nil {
+			if err != nil {
+				report(err)
+			}
+
+			return ExitCmd, ctx.Err()
+		}
+
+		success := status == ExitCmd && err == nil
+		if (item.op == tokenAnd && !success) || (item.op == tokenOr && success) {
+			continue
+		}
+
+		if err != nil {
+			report(err)
+		}
+
+		if item.background {
+			end := key + 1
+			for end < len(links) && links[end].op != tokenSequence {
+				end++
+			}
+
+			app.startJob(links[key:end])
+			status, err = ExitCmd, nil
+			key = end - 1
+			continue
+		}
+
+		var line *pipeline
+		if line, err = app.parsePipeline(ctx, item.stages); err != nil {
+			status = ExitCmd
+			continue
+		}
+
+		status, err = line.run(strings.NewReader(""), output, errOutput)
+		if status == ExitShell || status == ExitAll {
+			break
+		}
+	}
+
+	return status, err
+}
+
+// open opens the file named by each of the stage's redirections and uses it
+// to replace the relevant stream. If a file cannot be opened an ErrRedirect is
+// returned and any files which were already opened are closed.
+func (item *stage) open() error {
+	for _, target := range item.redirects {
+		var file *os.File
+		var err error
+
+		switch target.op {
+		case tokenRedirectIn:
+			file, err = os.Open(target.path)
+		case tokenRedirectAppend:
+			file, err = os.OpenFile(target.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		default:
+			file, err = os.OpenFile(target.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		}
+
+		if err != nil {
+			item.close()
+			return &ErrRedirect{Op: target.operator, Path: target.path, Err: err}
+		}
+
+		item.files = append(item.files, file)
+
+		switch target.op {
+		case tokenRedirectIn:
+			item.input = file
+		case tokenRedirectErr:
+			item.errOutput = file
+		default:
+			item.output = file
+		}
+	}
+
+	return nil
+}
+
+// close closes any files opened for the stage.
+func (item *stage) close() {
+	for _, file := range item.files {
+		file.Close()
+	}
+
+	item.files = nil
+}
+
+// run executes the stage, replacing the streams of its Context with those
+// provided unless they have been redirected.
+func (item *stage) run(input io.Reader, output, errOutput io.Writer) (ExitStatus, error) {
+	if item.input != nil {
+		input = item.input
+	}
+
+	if item.output != nil {
+		output = item.output
+	}
+
+	if item.errOutput != nil {
+		errOutput = item.errOutput
+	}
+
+	ctx := item.command.NewContext()
+	ctx.setStreams(input, output, errOutput)
+	if item.ctx != nil {
+		ctx.ctx = item.ctx
+	}
+
+	return item.command.execute(ctx, item.args)
+}
+
+// run executes each stage of the pipeline concurrently, reading the input of
+// the first stage from input and writing the output of the last stage to
+// output. Error output from every stage is written to errOutput. Once all
+// stages have finished, the ExitStatus of the last stage is returned along
+// with the first error returned by any stage in the order in which they
+// appear in the pipeline. Redirections are opened before any stage is run,
+// and if any fails its ErrRedirect is returned immediately.
+func (line *pipeline) run(input io.Reader, output, errOutput io.Writer) (ExitStatus, error) {
+	for key, item := range line.stages {
+		if err := item.open(); err != nil {
+			for _, opened := range line.stages[:key] {
+				opened.close()
+			}
+
+			return ExitCmd, err
+		}
+	}
+
+	count := len(line.stages)
+	statuses := make([]ExitStatus, count)
+	errs := make([]error, count)
+
+	if count > 1 {
+		errOutput = &syncWriter{writer: errOutput}
+	}
+
+	runStage := func(key int, input io.Reader, output io.Writer) {
+		statuses[key], errs[key] = line.stages[key].run(input, output, errOutput)
+		line.stages[key].close()
+
+		// signal the end of output to the next stage and cause any further
+		// writes from the previous stage to fail rather than block
+		if writer, ok := output.(*io.PipeWriter); ok && key < count-1 {
+			writer.Close()
+		}
+
+		if reader, ok := input.(*io.PipeReader); ok && key > 0 {
+			reader.Close()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for key := 0; key < count-1; key++ {
+		reader, writer := io.Pipe()
+
+		wg.Add(1)
+		go func(key int, input io.Reader) {
+			defer wg.Done()
+			runStage(key, input, writer)
+		}(key, input)
+
+		input = reader
+	}
+
+	runStage(count-1, input, output)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return statuses[count-1], err
+		}
+	}
+
+	return statuses[count-1], nil
+}
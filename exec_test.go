@@ -0,0 +1,343 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TmplPipeCmds are used throughout tests to ensure that pipelines behave as
+// expected. 'emit' prints each of its arguments on a new line, 'upper' copies
+// its input in upper case, 'count' prints the number of lines in its input,
+// 'first' prints only the first line of its input, and 'fail' returns
+// ExitUsage without reading its input.
+var TmplPipeCmds = []Command{
+	{
+		Name:  "emit",
+		Usage: "${name} [<line>...]",
+		Main: func(ctx *Context) ExitStatus {
+			for _, arg := range ctx.FlagSet().Args() {
+				ctx.Println(arg)
+			}
+			return ExitCmd
+		},
+	},
+	{
+		Name: "upper",
+		Main: func(ctx *Context) ExitStatus {
+			data, _ := ioutil.ReadAll(ctx.Input())
+			ctx.Print(strings.ToUpper(string(data)))
+			return ExitCmd
+		},
+	},
+	{
+		Name: "count",
+		Main: func(ctx *Context) ExitStatus {
+			count := 0
+			for scanner := bufio.NewScanner(ctx.Input()); scanner.Scan(); {
+				count++
+			}
+			ctx.Println(count)
+			return ExitCmd
+		},
+	},
+	{
+		Name: "first",
+		Main: func(ctx *Context) ExitStatus {
+			if scanner := bufio.NewScanner(ctx.Input()); scanner.Scan() {
+				ctx.Println(scanner.Text())
+			}
+			return ExitCmd
+		},
+	},
+	{
+		Name:  "fail",
+		Usage: "fail: always fails",
+		Main: func(ctx *Context) ExitStatus {
+			return ExitUsage
+		},
+	},
+}
+
+// WithPipeCommands runs a function providing an app with the commands from
+// TmplPipeCmds and its output.
+func WithPipeCommands(t *testing.T, name string, fn func(*App, *strings.Builder)) {
+	app := NewApp(name, true)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+
+	for _, cmd := range TmplPipeCmds {
+		if err := app.AddCommand(cmd); err != nil {
+			t.Fatalf("App(Name: %s).AddCommand: got error:\n%s", name, err)
+		}
+	}
+
+	fn(app, output)
+}
+
+// TestPipeline ensures that the output of each stage of a pipeline is passed
+// to the next and that the ExitStatus and error follow the documented rules.
+func TestPipeline(t *testing.T) {
+	WithPipeCommands(t, "TestPipeline", func(app *App, output *strings.Builder) {
+		expect := func(input string, status ExitStatus, result string) {
+			output.Reset()
+			if res, err := app.ExecuteString(input); err != nil {
+				t.Errorf("App.ExecuteString: got error with input `%s`:\n%s", input, err)
+			} else if res != status {
+				t.Errorf("App.ExecuteString: got ExitStatus %d with input `%s` expected %d", res, input, status)
+			} else if output.String() != result {
+				t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", output.String(), input,
+					result)
+			}
+		}
+
+		expect("emit a b | upper", ExitCmd, "A\nB\n")
+		expect("emit a b c|upper|count", ExitCmd, "3\n")
+		expect("emit 'a | b' | upper", ExitCmd, "A | B\n")
+		expect("upper | count", ExitCmd, "0\n")
+		expect("emit a | fail", ExitUsage, "fail: always fails\n")
+		expect("fail | count", ExitCmd, "fail: always fails\n0\n")
+
+		// a stage which stops reading early must not block those before it
+		lines := make([]string, 10000)
+		for key := range lines {
+			lines[key] = fmt.Sprint(key)
+		}
+		expect("emit "+strings.Join(lines, " ")+" | first", ExitCmd, "0\n")
+	})
+}
+
+// TestPipelineErrors ensures that invalid pipelines are rejected before any
+// stage is run.
+func TestPipelineErrors(t *testing.T) {
+	WithPipeCommands(t, "TestPipelineErrors", func(app *App, output *strings.Builder) {
+		expectParse := func(input string, pos int) {
+			if _, err := app.ExecuteString(input); err == nil {
+				t.Errorf("App.ExecuteString: expected error with input `%s`", input)
+			} else if val, ok := err.(*ErrParseInput); !ok {
+				t.Errorf("App.ExecuteString: expected error of type *ErrParseInput with input `%s`:\n%s", input, err)
+			} else if val.Position != pos {
+				t.Errorf("App.ExecuteString: got position %d with input `%s` expected %d", val.Position, input, pos)
+			}
+		}
+
+		expectParse("| count", 0)
+		expectParse("emit a |", 7)
+		expectParse("emit a | | count", 9)
+
+		output.Reset()
+		if _, err := app.ExecuteString("emit a | nothing"); err == nil {
+			t.Error("App.ExecuteString: expected error with non-existent command in pipeline")
+		} else if val, ok := err.(*ErrNoCmd); !ok || val.Name != "nothing" {
+			t.Error("App.ExecuteString: expected error of type *ErrNoCmd with non-existent command in pipeline:\n", err)
+		} else if output.Len() != 0 {
+			t.Error("App.ExecuteString: expected no output with non-existent command in pipeline, got:\n", output)
+		}
+
+		if _, err := app.ExecuteString("emit -bad | count"); err == nil {
+			t.Error("App.ExecuteString: expected error with invalid flags in pipeline")
+		} else if _, ok := err.(*ErrParseFlags); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrParseFlags with invalid flags in pipeline:\n", err)
+		}
+	})
+}
+
+// TestChain ensures that pipelines separated by ';', '&&', and '||' are run
+// according to the result of the pipeline before them.
+func TestChain(t *testing.T) {
+	WithPipeCommands(t, "TestChain", func(app *App, output *strings.Builder) {
+		expect := func(input string, status ExitStatus, errType error, result string) {
+			output.Reset()
+			res, err := app.ExecuteString(input)
+			if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", errType) {
+				t.Errorf("App.ExecuteString: got error of type %T with input `%s` expected %T:\n%v", err, input,
+					errType, err)
+			} else if res != status {
+				t.Errorf("App.ExecuteString: got ExitStatus %d with input `%s` expected %d", res, input, status)
+			} else if output.String() != result {
+				t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", output.String(), input,
+					result)
+			}
+		}
+
+		expect("emit a; emit b", ExitCmd, nil, "a\nb\n")
+		expect("emit a;emit b;", ExitCmd, nil, "a\nb\n")
+		expect("emit a && emit b", ExitCmd, nil, "a\nb\n")
+		expect("emit a || emit b", ExitCmd, nil, "a\n")
+		expect("fail && emit b", ExitUsage, nil, "fail: always fails\n")
+		expect("fail || emit b", ExitCmd, nil, "fail: always fails\nb\n")
+		expect("fail && emit b || emit c", ExitCmd, nil, "fail: always fails\nc\n")
+		expect("emit a || emit b && emit c", ExitCmd, nil, "a\nc\n")
+		expect("emit a b | count && emit c", ExitCmd, nil, "2\nc\n")
+		expect("nothing && emit b", ExitCmd, &ErrNoCmd{}, "")
+		expect("nothing || emit b", ExitCmd, nil, "nothing: command not found\nb\n")
+		expect("emit -bad || emit b", ExitCmd, nil, "flag provided but not defined: -bad\nUsage of emit:\n"+
+			"emit: failed to parse flags:\nflag provided but not defined: -bad\nb\n")
+		expect("emit a; nothing", ExitCmd, &ErrNoCmd{}, "a\n")
+		expect("exit -shell-only; emit b", ExitShell, nil, "")
+		expect("emit a && exit || emit b", ExitAll, nil, "a\n")
+		expect("emit a ';' b", ExitCmd, nil, "a\n;\nb\n")
+		expect("emit a && ; emit b", ExitCmd, &ErrParseInput{}, "")
+		expect("; emit b", ExitCmd, &ErrParseInput{}, "")
+		expect("emit a ||", ExitCmd, &ErrParseInput{}, "")
+	})
+}
+
+// TestRedirect ensures that the streams of a single command may be replaced
+// with files and that typed errors are returned when they cannot be opened.
+func TestRedirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRedirect")
+	if err != nil {
+		t.Fatal("ioutil.TempDir: got error:\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	WithPipeCommands(t, "TestRedirect", func(app *App, output *strings.Builder) {
+		run := func(input string) {
+			output.Reset()
+			if _, err := app.ExecuteString(input); err != nil {
+				t.Errorf("App.ExecuteString: got error with input `%s`:\n%s", input, err)
+			}
+		}
+
+		expectFile := func(input, name, result string) {
+			if data, err := ioutil.ReadFile(path(name)); err != nil {
+				t.Errorf("ioutil.ReadFile: got error reading '%s' with input `%s`:\n%s", name, input, err)
+			} else if string(data) != result {
+				t.Errorf("App.ExecuteString: got file contents %q with input `%s` expected %q", data, input, result)
+			}
+		}
+
+		run("emit a b > " + path("out.txt"))
+		expectFile("emit a b > out.txt", "out.txt", "a\nb\n")
+		if output.Len() != 0 {
+			t.Error("App.ExecuteString: expected no output with redirected output, got:\n", output)
+		}
+
+		run("emit c >> " + path("out.txt"))
+		expectFile("emit c >> out.txt", "out.txt", "a\nb\nc\n")
+
+		run("emit d >" + path("out.txt"))
+		expectFile("emit d >out.txt", "out.txt", "d\n")
+
+		run("fail 2> " + path("err.txt"))
+		expectFile("fail 2> err.txt", "err.txt", "fail: always fails\n")
+
+		run("upper < " + path("out.txt"))
+		if output.String() != "D\n" {
+			t.Errorf("App.ExecuteString: got output %q with input `upper < out.txt` expected %q", output, "D\n")
+		}
+
+		run("emit x y > " + path("pipe.txt") + " | count")
+		expectFile("emit x y > pipe.txt | count", "pipe.txt", "x\ny\n")
+		if output.String() != "0\n" {
+			t.Errorf("App.ExecuteString: got output %q with input `emit x y > pipe.txt | count` expected %q",
+				output, "0\n")
+		}
+
+		run("emit a2>" + path("digit.txt"))
+		expectFile("emit a2>digit.txt", "digit.txt", "a2\n")
+
+		output.Reset()
+		if _, err := app.ExecuteString("emit a > " + path("missing/out.txt") + "; emit b"); err != nil {
+			t.Error("App.ExecuteString: got error with unwritable path followed by valid command:\n", err)
+		} else if !strings.Contains(output.String(), "cannot redirect") || strings.Contains(output.String(), "a\n") {
+			t.Errorf("App.ExecuteString: expected redirection error and no output from 'emit a', got:\n%s", output)
+		}
+
+		if _, err := app.ExecuteString("upper < " + path("missing.txt") + " | emit a"); err == nil {
+			t.Error("App.ExecuteString: expected error with missing input file")
+		} else if val, ok := err.(*ErrRedirect); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrRedirect with missing input file:\n", err)
+		} else if val.Op != "<" || val.Path != path("missing.txt") {
+			t.Errorf("App.ExecuteString: got Op '%s' and Path '%s' with missing input file", val.Op, val.Path)
+		}
+
+		for _, input := range []string{"emit a >", "emit a > | count", "> out.txt", "emit a > ; emit b"} {
+			if _, err := app.ExecuteString(input); err == nil {
+				t.Errorf("App.ExecuteString: expected error with input `%s`", input)
+			} else if _, ok := err.(*ErrParseInput); !ok {
+				t.Errorf("App.ExecuteString: expected error of type *ErrParseInput with input `%s`:\n%s", input, err)
+			}
+		}
+	})
+}
+
+// TestSubstitution ensures that command substitutions are replaced with the
+// output of the command and that failures stop the outer command.
+func TestSubstitution(t *testing.T) {
+	WithPipeCommands(t, "TestSubstitution", func(app *App, output *strings.Builder) {
+		if err := app.AddCommand(Command{
+			Name: "nargs",
+			Main: func(ctx *Context) ExitStatus {
+				ctx.Println(ctx.FlagSet().NArg())
+				return ExitCmd
+			},
+		}); err != nil {
+			t.Fatal("App.AddCommand: got error:\n", err)
+		}
+
+		expect := func(input string, result string) {
+			output.Reset()
+			if _, err := app.ExecuteString(input); err != nil {
+				t.Errorf("App.ExecuteString: got error with input `%s`:\n%s", input, err)
+			} else if output.String() != result {
+				t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", output.String(), input,
+					result)
+			}
+		}
+
+		expect("emit $(emit primary)", "primary\n")
+		expect("nargs $(emit a b c)", "3\n")
+		expect(`nargs "$(emit a b c)"`, "1\n")
+		expect("nargs $(emit)", "0\n")
+		expect("emit x$(emit a b)y", "xa\nby\n")
+		expect("emit $(emit a b | count)", "2\n")
+		expect("emit $(emit $(emit nested))", "nested\n")
+		expect(`emit $(emit ')' "(")`, ")\n(\n")
+		expect(`emit '$(emit a)' \$(emit a)`, "$(emit a)\n$(emit\na)\n")
+		expect("set v=$(emit a); emit $v", "a\n")
+		expect("$(emit emit) a", "a\n")
+
+		output.Reset()
+		if _, err := app.ExecuteString("emit before $(nothing)"); err == nil {
+			t.Error("App.ExecuteString: expected error with non-existent command in substitution")
+		} else if val, ok := err.(*ErrSubstitution); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrSubstitution:\n", err)
+		} else if _, ok := val.Err.(*ErrNoCmd); !ok || val.Input != "nothing" {
+			t.Errorf("App.ExecuteString: got Input '%s' and Err %#v expected 'nothing' and *ErrNoCmd", val.Input,
+				val.Err)
+		} else if output.Len() != 0 {
+			t.Error("App.ExecuteString: expected no output with failed substitution, got:\n", output)
+		}
+
+		if _, err := app.ExecuteString("emit $(fail)"); err == nil {
+			t.Error("App.ExecuteString: expected error with failing command in substitution")
+		} else if val, ok := err.(*ErrSubstitution); !ok || val.Status != ExitUsage || val.Err != nil {
+			t.Error("App.ExecuteString: expected error of type *ErrSubstitution with ExitUsage:\n", err)
+		}
+
+		output.Reset()
+		if _, err := app.ExecuteString("emit $(fail) || emit recovered"); err != nil {
+			t.Error("App.ExecuteString: got error with failed substitution followed by '||':\n", err)
+		} else if !strings.Contains(output.String(), "command did not succeed") ||
+			!strings.HasSuffix(output.String(), "recovered\n") {
+			t.Error("App.ExecuteString: expected substitution error and output from 'emit recovered', got:\n", output)
+		}
+
+		if _, err := app.ExecuteString("emit $(emit a"); err == nil {
+			t.Error("App.ExecuteString: expected error with unterminated substitution")
+		} else if val, ok := err.(*ErrParseInput); !ok || val.Position != 5 {
+			t.Error("App.ExecuteString: expected error of type *ErrParseInput at position 5:\n", err)
+		}
+	})
+}
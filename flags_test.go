@@ -0,0 +1,220 @@
+package shell
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TmplPersistentCmd is used to ensure that persistent flags are accepted by
+// sub-commands at any depth, both before and after their names.
+var TmplPersistentCmd = Command{
+	Name: "db",
+	PersistentFlags: func(ctx *Context) {
+		ctx.Set("verbose", ctx.FlagSet().Bool("verbose", false, "print every query"))
+		ctx.Set("env", ctx.FlagSet().String("env", "dev", "environment to connect to"))
+	},
+	SetFlags: func(ctx *Context) {
+		ctx.Set("local", ctx.FlagSet().Bool("local", false, "flag of db alone"))
+	},
+	Main: func(ctx *Context) ExitStatus {
+		ctx.Println("db", *ctx.MustGet("verbose").(*bool), ctx.FlagSet().Args())
+		return ExitCmd
+	},
+	SubCommands: []Command{
+		{
+			Name: "migrate",
+			SetFlags: func(ctx *Context) {
+				ctx.Set("steps", ctx.FlagSet().Int("steps", 1, "number of migrations to run"))
+			},
+			Main: func(ctx *Context) ExitStatus {
+				ctx.Println("migrate", *ctx.MustGet("verbose").(*bool), *ctx.MustGet("env").(*string),
+					*ctx.MustGet("steps").(*int), *ctx.MustGet("json").(*bool))
+				return ExitCmd
+			},
+		},
+		{
+			Name: "schema",
+			Main: blankMainFunc,
+			SubCommands: []Command{
+				{
+					Name: "dump",
+					Main: func(ctx *Context) ExitStatus {
+						ctx.Println("dump", *ctx.MustGet("verbose").(*bool), ctx.FlagSet().Args())
+						return ExitCmd
+					},
+				},
+			},
+		},
+	},
+}
+
+// TestPersistentFlags ensures that persistent flags and App flags are accepted
+// by every command which inherits them and that their values are accessible
+// through the Context.
+func TestPersistentFlags(t *testing.T) {
+	app := NewApp("TestPersistentFlags", true)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+	app.SetFlags = func(ctx *Context) {
+		ctx.Set("json", ctx.FlagSet().Bool("json", false, "print output as JSON"))
+	}
+
+	if err := app.AddCommand(TmplPersistentCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	expect := func(input, res string) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err != nil {
+			t.Errorf("App.ExecuteString: got error with input '%s':\n%s", input, err)
+		} else if output.String() != res {
+			t.Errorf("App.ExecuteString: got output %q with input '%s' expected %q", output.String(), input, res)
+		}
+	}
+
+	expect("db -verbose migrate", "migrate true dev 1 false\n")
+	expect("db -env prod -json migrate -steps 2", "migrate false prod 2 true\n")
+	expect("db migrate -verbose -env=prod", "migrate true prod 1 false\n")
+	expect("db -verbose schema dump a", "dump true [a]\n")
+	expect("db schema -verbose dump -- -a", "dump true [-a]\n")
+	expect("db -local migrate", "db false [migrate]\n")
+	expect("db -verbose -- migrate", "db true [migrate]\n")
+	expect("db -json", "db false []\n")
+
+	db, _ := app.GetByName("db")
+	if res, args, err := db.match([]string{"db", "-env", "prod", "migrate", "a"}); err != nil {
+		t.Error("Command.match: got error:\n", err)
+	} else if res.FullName() != "db migrate" {
+		t.Errorf("Command.match: got command '%s' expected 'db migrate'", res.FullName())
+	} else if expected := []string{"migrate", "-env", "prod", "a"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Command.match: got input %q expected %q", args, expected)
+	}
+
+	// db accepts the argument, so it is not taken as a misspelled sub-command
+	expect("db -verbose migrat", "db true [migrat]\n")
+
+	if _, err := app.ExecuteString("exit -json -shell-only"); err != nil {
+		t.Error("App.ExecuteString: got error with App flag on default command:\n", err)
+	}
+
+	output.Reset()
+	app.ExecuteString("db flags migrate")
+	res := output.String()
+	for _, str := range []string{"-steps", "Inherited flags:", "-verbose", "Global flags:", "-json"} {
+		if !strings.Contains(res, str) {
+			t.Errorf("flags: expected '%s' got output:\n%s", str, res)
+		}
+	}
+
+	if strings.Contains(res[:strings.Index(res, "Inherited flags:")], "-verbose") {
+		t.Errorf("flags: expected inherited flags to be listed separately got output:\n%s", res)
+	}
+
+	if _, _, res := app.complete("db -verbose mi"); !reflect.DeepEqual(res, []string{"migrate"}) {
+		t.Errorf("App.complete: got %q after persistent flag expected 'migrate'", res)
+	}
+
+	if _, _, res := app.complete("db migrate -"); !reflect.DeepEqual(res, []string{"-env", "-json", "-steps", "-verbose"}) {
+		t.Errorf("App.complete: got %q expected inherited flags", res)
+	}
+}
+
+// TestRedefinedFlags ensures that AddCommand returns an error rather than the
+// command panicking when it runs if a command redefines an inherited flag.
+func TestRedefinedFlags(t *testing.T) {
+	app := NewApp("TestRedefinedFlags", false)
+	app.SetFlags = func(ctx *Context) {
+		ctx.FlagSet().Bool("json", false, "print output as JSON")
+	}
+
+	expectError := func(cmd Command, name string) {
+		if err := app.AddCommand(cmd); err == nil {
+			t.Errorf("App.AddCommand: expected error with command redefining flag '%s'", name)
+		} else if expected := "redefines flag '" + name + "'"; !strings.Contains(err.Error(), expected) {
+			t.Errorf("App.AddCommand: expected error containing `%s` got:\n%s", expected, err)
+		}
+	}
+
+	expectError(Command{
+		Name: "x",
+		SetFlags: func(ctx *Context) {
+			ctx.FlagSet().Bool("json", false, "redefined App flag")
+		},
+		Main: blankMainFunc,
+	}, "json")
+
+	expectError(Command{
+		Name: "y",
+		PersistentFlags: func(ctx *Context) {
+			ctx.FlagSet().Bool("verbose", false, "persistent flag")
+		},
+		Main: blankMainFunc,
+		SubCommands: []Command{
+			{
+				Name: "sub",
+				SetFlags: func(ctx *Context) {
+					ctx.FlagSet().Bool("verbose", false, "redefined persistent flag")
+				},
+				Main: blankMainFunc,
+			},
+		},
+	}, "verbose")
+
+	if _, err := app.GetByName("x"); err == nil {
+		t.Error("App.GetByName: expected command redefining a flag not to be added")
+	}
+}
+
+// TestRedefinedDefaultFlags ensures that a default command redefining one of
+// the App's SetFlags, which are set only after the default commands are added,
+// returns an error when executed rather than panicking.
+func TestRedefinedDefaultFlags(t *testing.T) {
+	app := NewApp("TestRedefinedDefaultFlags", true)
+	errOutput := &strings.Builder{}
+	app.ErrOutput = errOutput
+	app.SetFlags = func(ctx *Context) {
+		ctx.FlagSet().Bool("clear", false, "clear the screen")
+	}
+
+	if _, err := app.ExecuteString("history"); err == nil {
+		t.Error("App.ExecuteString: expected error with command redefining flag 'clear'")
+	} else if expected := "redefines flag 'clear'"; !strings.Contains(err.Error(), expected) {
+		t.Errorf("App.ExecuteString: expected error containing `%s` got:\n%s", expected, err)
+	}
+
+	if res := errOutput.String(); strings.Contains(res, "flag redefined") {
+		t.Errorf("App.ExecuteString: expected no message from the flag package got error output:\n%s", res)
+	}
+}
+
+// TestAppFlagsSubCommand ensures that the default flags sub-command is added
+// to commands which accept no flags but those of the App.
+func TestAppFlagsSubCommand(t *testing.T) {
+	app := NewApp("TestAppFlagsSubCommand", false)
+	output := &strings.Builder{}
+	app.Output = output
+	app.SetFlags = func(ctx *Context) {
+		ctx.FlagSet().Bool("json", false, "print output as JSON")
+	}
+
+	if err := app.AddCommand(Command{
+		Name:        "plain",
+		Main:        blankMainFunc,
+		SubCommands: []Command{{Name: "sub", Main: blankMainFunc}},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	plain, _ := app.GetByName("plain")
+	if _, err := plain.GetSubCommand("flags"); err != nil {
+		t.Fatal("Command.GetSubCommand: expected default flags sub-command with App flags:\n", err)
+	}
+
+	if _, err := app.ExecuteString("plain flags sub"); err != nil {
+		t.Error("App.ExecuteString: got error with flags sub-command:\n", err)
+	} else if res := output.String(); !strings.Contains(res, "Global flags:") || !strings.Contains(res, "-json") {
+		t.Errorf("flags: expected App flags to be listed got output:\n%s", res)
+	}
+}
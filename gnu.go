@@ -0,0 +1,281 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// boolFlag is implemented by flag.Value types which do not require a value,
+// such as those registered by flag.FlagSet.Bool.
+type boolFlag interface {
+	IsBoolFlag() bool
+}
+
+// gnuFlags returns true if the command parses its flags in the GNU style,
+// either because it sets GNUFlags itself or because its App does.
+func (cmd *Command) gnuFlags() bool {
+	return cmd.GNUFlags || (cmd.app != nil && cmd.app.GNUFlags)
+}
+
+// flagPrefix returns the prefix with which the command's flags are provided
+// by their full names: '--' if it parses its flags in the GNU style,
+// otherwise '-'.
+func (cmd *Command) flagPrefix() string {
+	if cmd.gnuFlags() {
+		return "--"
+	}
+
+	return "-"
+}
+
+// SetShortFlag takes a single-character short name and the name of a flag
+// registered with the FlagSet, and allows the flag to be provided as -<short>
+// when the command parses its flags in the GNU style. It should be called
+// within SetFlags. Short names are ignored otherwise.
+func (context *Context) SetShortFlag(short, name string) {
+	if context.shortFlags == nil {
+		context.shortFlags = make(map[string]string)
+	}
+
+	context.shortFlags[short] = name
+}
+
+// parseFlags parses the arguments with the FlagSet of the Context, in the GNU
+// style as with parseGNU if the command sets GNUFlags or is part of an App
+// which does, or otherwise as with flag.FlagSet.Parse.
+func (context *Context) parseFlags(args []string) error {
+	if context.command != nil && context.command.gnuFlags() {
+		return parseGNU(context.flagSet, context.shortFlags, args, true)
+	}
+
+	return context.flagSet.Parse(args)
+}
+
+// parseGNU parses the arguments with the FlagSet in the GNU style, such that
+// positional arguments remain available through its Args. Flags may be
+// provided as --name, --name=value, or --name value, or by a short name as
+// found in shorts: -n, -nvalue, or -n value. Several short flags which do not
+// take a value may be combined, as in -abc, and the last may be followed by a
+// value. For compatibility, a single '-' followed by the full name of a flag
+// is accepted as with the flag package. A '--' ends the flags, with everything
+// following it taken as positional arguments.
+//
+// If intersperse is true, flags may appear anywhere among the positional
+// arguments, otherwise parsing stops at the first positional argument as with
+// the flag package. Errors are reported as by flag.FlagSet.Parse, but with
+// flags shown as --name and followed by the defaults of getGNUDefaults, and
+// flag.ErrHelp is returned if -h or --help is provided but not defined.
+func parseGNU(flags *flag.FlagSet, shorts map[string]string, args []string, intersperse bool) error {
+	positional := make([]string, 0)
+
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+
+		if arg == "--" {
+			positional = append(positional, args...)
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			if !intersperse {
+				positional = append(positional, args...)
+				break
+			}
+
+			continue
+		}
+
+		var err error
+		if args, err = parseGNUFlag(flags, shorts, arg, args); err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintln(flags.Output(), err)
+			}
+
+			// flags.Usage is not called as it shows flags as -name
+			fmt.Fprintf(flags.Output(), "Usage of %s:\n%s", flags.Name(), getGNUDefaults(flags, shorts))
+
+			return err
+		}
+	}
+
+	// parse no flags such that Args returns the positional arguments
+	return flags.Parse(append([]string{"--"}, positional...))
+}
+
+// parseGNUFlag takes a FlagSet, its short names, a single argument beginning
+// with '-', and the arguments following it, and sets the flag or flags which
+// the argument provides. The arguments remaining after any value consumed are
+// returned. Errors show a flag by its short name only if it is not defined,
+// and otherwise as --name.
+func parseGNUFlag(flags *flag.FlagSet, shorts map[string]string, arg string, args []string) ([]string, error) {
+	long := strings.HasPrefix(arg, "--")
+	name := strings.TrimLeft(arg, "-")
+	value, hasValue := "", false
+	if index := strings.IndexByte(name, '='); index != -1 {
+		name, value, hasValue = name[:index], name[index+1:], true
+	}
+
+	// a single '-' is followed by short names unless it is a full flag name
+	if !long && !(len(name) > 1 && flags.Lookup(name) != nil) {
+		for key, char := range name {
+			short := string(char)
+			item := lookupShort(flags, shorts, short)
+			if item == nil {
+				if short == "h" {
+					return nil, flag.ErrHelp
+				}
+
+				return nil, fmt.Errorf("flag provided but not defined: -%s", short)
+			}
+
+			if isBoolFlag(item) {
+				// the last bool flag may be followed by an explicit value
+				if key+len(short) == len(name) && hasValue {
+					return args, setFlag(flags, item, value)
+				}
+
+				if err := setFlag(flags, item, "true"); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			// any remaining characters are the value of the flag
+			if rest := name[key+len(short):]; rest != "" {
+				if hasValue {
+					rest += "=" + value
+				}
+
+				return args, setFlag(flags, item, rest)
+			}
+
+			if hasValue {
+				return args, setFlag(flags, item, value)
+			}
+
+			if len(args) == 0 {
+				return nil, fmt.Errorf("flag needs an argument: --%s", item.Name)
+			}
+
+			return args[1:], setFlag(flags, item, args[0])
+		}
+
+		return args, nil
+	}
+
+	item := flags.Lookup(name)
+	if item == nil {
+		if name == "help" || name == "h" {
+			return nil, flag.ErrHelp
+		}
+
+		return nil, fmt.Errorf("flag provided but not defined: --%s", name)
+	}
+
+	if !hasValue && !isBoolFlag(item) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("flag needs an argument: --%s", name)
+		}
+
+		value, hasValue, args = args[0], true, args[1:]
+	}
+
+	if !hasValue {
+		value = "true"
+	}
+
+	return args, setFlag(flags, item, value)
+}
+
+// lookupShort returns the flag with the short name provided, or with the name
+// itself if it has no short name, or nil if there is no such flag.
+func lookupShort(flags *flag.FlagSet, shorts map[string]string, short string) *flag.Flag {
+	if name, ok := shorts[short]; ok {
+		return flags.Lookup(name)
+	}
+
+	return flags.Lookup(short)
+}
+
+// isBoolFlag returns true if the flag does not require a value.
+func isBoolFlag(item *flag.Flag) bool {
+	value, ok := item.Value.(boolFlag)
+	return ok && value.IsBoolFlag()
+}
+
+// setFlag sets the value of a flag, returning an error in the same form as
+// flag.FlagSet.Parse if the value is invalid, but with the flag shown as
+// --name.
+func setFlag(flags *flag.FlagSet, item *flag.Flag, value string) error {
+	if err := flags.Set(item.Name, value); err != nil {
+		return fmt.Errorf("invalid value %q for flag --%s: %v", value, item.Name, err)
+	}
+
+	return nil
+}
+
+// getGNUDefaults takes a FlagSet and its short names and returns the same as
+// getDefaults, with each flag shown as --name and preceded by its short name,
+// if any, as in -n, --name.
+func getGNUDefaults(flags *flag.FlagSet, shorts map[string]string) string {
+	names := make(map[string]string)
+	for short, name := range shorts {
+		names[name] = short
+	}
+
+	lines := strings.SplitAfter(getDefaults(flags), "\n")
+	for key, line := range lines {
+		if !strings.HasPrefix(line, "  -") {
+			continue
+		}
+
+		name := line[3:]
+		if end := strings.IndexAny(name, " \t\n"); end != -1 {
+			name = name[:end]
+		}
+
+		prefix := "      --"
+		if short, ok := names[name]; ok {
+			prefix = "  -" + short + ", --"
+		}
+
+		lines[key] = prefix + line[3:]
+	}
+
+	return strings.Join(lines, "")
+}
+
+// getGNUShortDefaults does the same as getShortDefaults but shows each flag
+// as [--name], or as [-n|--name] if it has a short name.
+func getGNUShortDefaults(flags *flag.FlagSet, shorts map[string]string) string {
+	names := make(map[string]string)
+	for short, name := range shorts {
+		names[name] = short
+	}
+
+	list := make([]string, 0)
+	flags.VisitAll(func(item *flag.Flag) {
+		if short, ok := names[item.Name]; ok {
+			list = append(list, fmt.Sprintf("[-%s|--%s]", short, item.Name))
+		} else {
+			list = append(list, fmt.Sprintf("[--%s]", item.Name))
+		}
+	})
+
+	return strings.Join(list, " ")
+}
+
+// flagDefaults takes a Context whose FlagSet holds flags accepted by the
+// command and returns the same as getDefaults, or getGNUDefaults if the
+// command parses its flags in the GNU style.
+func (cmd *Command) flagDefaults(ctx *Context) string {
+	if cmd.gnuFlags() {
+		return getGNUDefaults(ctx.FlagSet(), ctx.shortFlags)
+	}
+
+	return getDefaults(ctx.FlagSet())
+}
@@ -0,0 +1,182 @@
+package shell
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseGNU ensures that flags are parsed in the GNU style.
+func TestParseGNU(t *testing.T) {
+	newFlags := func() *flag.FlagSet {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		flags.Bool("a", false, "")
+		flags.Bool("b", false, "")
+		flags.Bool("force", false, "")
+		flags.String("name", "", "")
+		flags.Int("count", 0, "")
+		return flags
+	}
+
+	shorts := map[string]string{"f": "force", "n": "name", "c": "count"}
+
+	expect := func(args []string, intersperse bool, values map[string]string, positional ...string) {
+		flags := newFlags()
+		if err := parseGNU(flags, shorts, args, intersperse); err != nil {
+			t.Errorf("parseGNU: got error with %q:\n%s", args, err)
+			return
+		}
+
+		for name, value := range values {
+			if res := flags.Lookup(name).Value.String(); res != value {
+				t.Errorf("parseGNU: got '%s' for flag '%s' with %q expected '%s'", res, name, args, value)
+			}
+		}
+
+		if res := flags.Args(); len(res) > 0 || len(positional) > 0 {
+			if !reflect.DeepEqual(res, positional) {
+				t.Errorf("parseGNU: got arguments %q with %q expected %q", res, args, positional)
+			}
+		}
+	}
+
+	expect([]string{"app1", "--force", "app2"}, true, map[string]string{"force": "true"}, "app1", "app2")
+	expect([]string{"-abf"}, true, map[string]string{"a": "true", "b": "true", "force": "true"})
+	expect([]string{"-c5", "x"}, true, map[string]string{"count": "5"}, "x")
+	expect([]string{"-ac", "3"}, true, map[string]string{"a": "true", "count": "3"})
+	expect([]string{"--count=5", "--name", "x y"}, true, map[string]string{"count": "5", "name": "x y"})
+	expect([]string{"-n=foo", "-f=false"}, true, map[string]string{"name": "foo", "force": "false"})
+	expect([]string{"-name", "x", "-count", "2"}, true, map[string]string{"name": "x", "count": "2"})
+	expect([]string{"-a", "--", "-b", "x"}, true, map[string]string{"a": "true", "b": "false"}, "-b", "x")
+	expect([]string{"-", "x"}, true, nil, "-", "x")
+	expect([]string{"-a", "x", "-b"}, false, map[string]string{"a": "true", "b": "false"}, "x", "-b")
+
+	expectErr := func(args []string, msg string) {
+		if err := parseGNU(newFlags(), shorts, args, true); err == nil {
+			t.Errorf("parseGNU: expected error with %q", args)
+		} else if !strings.HasPrefix(err.Error(), msg) {
+			t.Errorf("parseGNU: got error '%s' with %q expected '%s'", err, args, msg)
+		}
+	}
+
+	expectErr([]string{"--nope"}, undefinedFlag+"--nope")
+	expectErr([]string{"-az"}, undefinedFlag+"-z")
+	expectErr([]string{"x", "--count"}, missingValue+"--count")
+	expectErr([]string{"-c"}, missingValue+"--count")
+	expectErr([]string{"--count=x"}, `invalid value "x" for flag --count`)
+	expectErr([]string{"-h"}, flag.ErrHelp.Error())
+	expectErr([]string{"--help"}, flag.ErrHelp.Error())
+}
+
+// TestGNUFlags ensures that commands with GNUFlags parse their flags in the
+// GNU style and describe them accordingly.
+func TestGNUFlags(t *testing.T) {
+	app := NewApp("TestGNUFlags", false)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+
+	if err := app.AddCommand(Command{
+		Name:     "deploy",
+		Usage:    "${name} ${shortFlags} <app>...:\n\n${flags}",
+		GNUFlags: true,
+		Options: &struct {
+			Region string `flag:"region" short:"r" default:"us" usage:"region to deploy to"`
+		}{},
+		SetFlags: func(ctx *Context) {
+			ctx.Set("force", ctx.FlagSet().Bool("force", false, "skip checks"))
+			ctx.SetShortFlag("f", "force")
+			ctx.Set("dry", ctx.FlagSet().Bool("dry-run", false, "print what would be deployed"))
+		},
+		Main: func(ctx *Context) ExitStatus {
+			ctx.Println(*ctx.MustGet("force").(*bool), *ctx.MustGet("dry").(*bool),
+				reflect.ValueOf(ctx.Options()).Elem().Field(0), ctx.FlagSet().Args())
+			return ExitCmd
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	cmd, _ := app.GetByName("deploy")
+	if !strings.HasPrefix(cmd.Usage, "deploy [--dry-run] [-f|--force] [-r|--region] <app>...:") {
+		t.Errorf("Command.Usage: got '%s' with ${shortFlags}", cmd.Usage)
+	}
+
+	for _, str := range []string{"      --dry-run\n", "  -f, --force\n", "  -r, --region string\n"} {
+		if !strings.Contains(cmd.Usage, str) {
+			t.Errorf("Command.Usage: expected %q with ${flags} got:\n%s", str, cmd.Usage)
+		}
+	}
+
+	expect := func(input, res string) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err != nil {
+			t.Errorf("App.ExecuteString: got error with input '%s':\n%s", input, err)
+		} else if output.String() != res {
+			t.Errorf("App.ExecuteString: got output %q with input '%s' expected %q", output.String(), input, res)
+		}
+	}
+
+	expect("deploy app1 -force", "true false us [app1]\n")
+	expect("deploy app1 -fr eu app2 --dry-run", "true true eu [app1 app2]\n")
+	expect("deploy --region=ap -- --force", "false false ap [--force]\n")
+
+	output.Reset()
+	if _, err := app.ExecuteString("deploy --forse"); err == nil {
+		t.Error("App.ExecuteString: expected error with misspelled flag")
+	} else if val, ok := err.(*ErrParseFlags); !ok {
+		t.Error("App.ExecuteString: expected error of type *ErrParseFlags with misspelled flag:\n", err)
+	} else if !reflect.DeepEqual(val.Suggestions, []string{"--force"}) {
+		t.Errorf("App.ExecuteString: got suggestions %q with misspelled flag", val.Suggestions)
+	}
+
+	for _, str := range []string{"flag provided but not defined: --forse\n", "  -f, --force\n", "  -r, --region string\n"} {
+		if !strings.Contains(output.String(), str) {
+			t.Errorf("App.ExecuteString: expected %q with misspelled flag got output:\n%s", str, output.String())
+		}
+	}
+
+	if _, _, res := app.complete("deploy --"); !reflect.DeepEqual(res, []string{"--dry-run", "--force", "--region"}) {
+		t.Errorf("App.complete: got %q expected long flags", res)
+	}
+
+	if _, _, res := app.complete("deploy app1 --region "); len(res) != 0 {
+		t.Errorf("App.complete: got %q for flag value without completion", res)
+	}
+}
+
+// TestAppGNUFlags ensures that the flags of every command are parsed in the
+// GNU style if the App's GNUFlags is set, including persistent flags preceding
+// the name of a sub-command.
+func TestAppGNUFlags(t *testing.T) {
+	app := NewApp("TestAppGNUFlags", true)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+	app.GNUFlags = true
+
+	if err := app.AddCommand(TmplPersistentCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	app.SetFlags = func(ctx *Context) {
+		ctx.Set("json", ctx.FlagSet().Bool("json", false, "print output as JSON"))
+	}
+
+	expect := func(input, res string) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err != nil {
+			t.Errorf("App.ExecuteString: got error with input '%s':\n%s", input, err)
+		} else if output.String() != res {
+			t.Errorf("App.ExecuteString: got output %q with input '%s' expected %q", output.String(), input, res)
+		}
+	}
+
+	expect("db --verbose --env=prod migrate --steps 3", "migrate true prod 3 false\n")
+	expect("db migrate --json --verbose", "migrate true dev 1 true\n")
+	expect("db schema dump a --verbose", "dump true [a]\n")
+	expect("exit --json --shell-only", "")
+}
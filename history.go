@@ -0,0 +1,324 @@
+package shell
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+// DefaultHistorySize is the maximum number of history entries kept when the
+// App's HistorySize is zero.
+const DefaultHistorySize = 500
+
+// ErrNoEvent is returned from ExpandHistory if the input refers to a history
+// entry which does not exist.
+type ErrNoEvent struct {
+	// Event is the reference as found in the input, such as '!!' or '!12'.
+	Event string
+}
+
+// Error implements the error interface for ErrNoEvent.
+func (err *ErrNoEvent) Error() string {
+	return fmt.Sprintf("App.ExpandHistory: event '%s' not found", err.Event)
+}
+
+// HistoryStore loads and saves the history of an App between sessions.
+type HistoryStore interface {
+	// Load returns all entries in the order in which they were added.
+	Load() ([]string, error)
+
+	// Save replaces all entries with those provided.
+	Save(entries []string) error
+}
+
+// FileHistory is a HistoryStore which keeps entries in the file at the path
+// it holds, one per line. A file which does not exist holds no entries.
+type FileHistory string
+
+// Load implements HistoryStore for FileHistory.
+func (path FileHistory) Load() ([]string, error) {
+	data, err := ioutil.ReadFile(string(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, nil
+}
+
+// Save implements HistoryStore for FileHistory.
+func (path FileHistory) Save(entries []string) error {
+	data := ""
+	if len(entries) > 0 {
+		data = strings.Join(entries, "\n") + "\n"
+	}
+
+	return ioutil.WriteFile(string(path), []byte(data), 0600)
+}
+
+// MemoryHistory is a HistoryStore which keeps entries in memory and is mostly
+// useful in tests.
+type MemoryHistory struct {
+	Entries []string
+}
+
+// Load implements HistoryStore for MemoryHistory.
+func (store *MemoryHistory) Load() ([]string, error) {
+	return append([]string{}, store.Entries...), nil
+}
+
+// Save implements HistoryStore for MemoryHistory.
+func (store *MemoryHistory) Save(entries []string) error {
+	store.Entries = append([]string{}, entries...)
+	return nil
+}
+
+// historyStore returns the HistoryStore in use by the App, or nil if history
+// is not kept between sessions.
+func (app *App) historyStore() HistoryStore {
+	if app.HistoryStore != nil {
+		return app.HistoryStore
+	}
+
+	if app.HistoryFile != "" {
+		return FileHistory(app.HistoryFile)
+	}
+
+	return nil
+}
+
+// historySize returns the maximum number of history entries to be kept.
+func (app *App) historySize() int {
+	if app.HistorySize <= 0 {
+		return DefaultHistorySize
+	}
+
+	return app.HistorySize
+}
+
+// LoadHistory replaces the history of the App with the entries held by its
+// HistoryStore or HistoryFile, keeping only the most recent if there are more
+// than HistorySize. It is called by Main before the first line is read.
+func (app *App) LoadHistory() error {
+	store := app.historyStore()
+	if store == nil {
+		return nil
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("App.LoadHistory: failed to load history:\n%s", err)
+	}
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if size := app.historySize(); len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+
+	app.history = entries
+	return nil
+}
+
+// History returns a copy of all history entries, from oldest to newest.
+func (app *App) History() []string {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	return append([]string{}, app.history...)
+}
+
+// AddHistory takes a line of input and adds it to the history, saving the
+// history to the HistoryStore or HistoryFile if either is set. Blank lines are
+// ignored, as are lines beginning with a space if HistoryIgnoreSpace is true.
+// If HistoryDedup is true, earlier entries identical to the line are removed.
+// The oldest entries are removed once there are more than HistorySize.
+func (app *App) AddHistory(line string) error {
+	if strings.TrimSpace(line) == "" || (app.HistoryIgnoreSpace && strings.HasPrefix(line, " ")) {
+		return nil
+	}
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if app.HistoryDedup {
+		entries := app.history[:0]
+		for _, entry := range app.history {
+			if entry != line {
+				entries = append(entries, entry)
+			}
+		}
+
+		app.history = entries
+	}
+
+	app.history = append(app.history, line)
+	if size := app.historySize(); len(app.history) > size {
+		app.history = app.history[len(app.history)-size:]
+	}
+
+	return app.saveHistory()
+}
+
+// ClearHistory removes all history entries, saving the empty history to the
+// HistoryStore or HistoryFile if either is set.
+func (app *App) ClearHistory() error {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	app.history = nil
+	return app.saveHistory()
+}
+
+// saveHistory saves the history of the App to its HistoryStore, if any. The
+// App's mutex must be held.
+func (app *App) saveHistory() error {
+	store := app.historyStore()
+	if store == nil {
+		return nil
+	}
+
+	if err := store.Save(app.history); err != nil {
+		return fmt.Errorf("App.AddHistory: failed to save history:\n%s", err)
+	}
+
+	return nil
+}
+
+// ExpandHistory takes a line of input and replaces each reference to a
+// history entry outside of single quotes with the entry itself: '!!' with the
+// most recent entry, '!n' with the entry numbered n as listed by the default
+// history command, and '!prefix' with the most recent entry beginning with
+// prefix. A '!' preceded by a backslash or followed by whitespace, a quote,
+// '=', '(', or the end of the line is left as is, as in `a != b`. If an entry
+// does not exist an ErrNoEvent is returned. Main expands history before
+// executing each line.
+func (app *App) ExpandHistory(line string) (string, error) {
+	entries := app.History()
+	expanded := &strings.Builder{}
+	single, double := false, false
+
+	for pos := 0; pos < len(line); {
+		char, size := utf8.DecodeRuneInString(line[pos:])
+
+		switch {
+		case char == '\'' && !double:
+			single = !single
+		case char == '"' && !single:
+			double = !double
+		case char == '\\' && !single && pos+size < len(line):
+			// keep the escape and the character it escapes as is
+			_, escapedSize := utf8.DecodeRuneInString(line[pos+size:])
+			expanded.WriteString(line[pos : pos+size+escapedSize])
+			pos += size + escapedSize
+			continue
+		case char == '!' && !single:
+			if event := readEvent(line[pos+size:]); event != "" {
+				entry, ok := findEvent(entries, event)
+				if !ok {
+					return "", &ErrNoEvent{Event: "!" + event}
+				}
+
+				expanded.WriteString(entry)
+				pos += size + len(event)
+				continue
+			}
+		}
+
+		expanded.WriteRune(char)
+		pos += size
+	}
+
+	return expanded.String(), nil
+}
+
+// readEvent takes the input following a '!' and returns the reference to a
+// history entry at its beginning, without the '!', or an empty string if
+// there is none.
+func readEvent(input string) string {
+	if strings.HasPrefix(input, "!") {
+		return "!"
+	}
+
+	end := strings.IndexFunc(input, func(char rune) bool {
+		return unicode.IsSpace(char) || strings.ContainsRune("|;&<>'\"\\=(", char)
+	})
+
+	if end == -1 {
+		return input
+	}
+
+	return input[:end]
+}
+
+// findEvent takes a list of history entries and a reference as returned by
+// readEvent and returns the entry which it refers to and whether it exists.
+func findEvent(entries []string, event string) (string, bool) {
+	if event == "!" {
+		if len(entries) == 0 {
+			return "", false
+		}
+
+		return entries[len(entries)-1], true
+	}
+
+	if number, err := strconv.Atoi(event); err == nil {
+		if number < 1 || number > len(entries) {
+			return "", false
+		}
+
+		return entries[number-1], true
+	}
+
+	for key := len(entries) - 1; key >= 0; key-- {
+		if strings.HasPrefix(entries[key], event) {
+			return entries[key], true
+		}
+	}
+
+	return "", false
+}
+
+// syncHistory takes a readline instance and the history entries which it
+// last received and, if the history of the App has since changed, replaces
+// the history of the instance with that of the App. The entries which the
+// instance now holds are returned.
+func (app *App) syncHistory(rl *readline.Instance, synced []string) []string {
+	entries := app.History()
+
+	if len(entries) == len(synced) {
+		same := true
+		for key := range entries {
+			if entries[key] != synced[key] {
+				same = false
+				break
+			}
+		}
+
+		if same {
+			return synced
+		}
+	}
+
+	rl.ResetHistory()
+	for _, entry := range entries {
+		rl.SaveHistory(entry)
+	}
+
+	return entries
+}
@@ -0,0 +1,181 @@
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestAddHistory ensures that entries are added to the history and saved
+// according to the history settings of the App.
+func TestAddHistory(t *testing.T) {
+	store := &MemoryHistory{Entries: []string{"one", "two", "three"}}
+	app := NewApp("TestAddHistory", false)
+	app.HistoryStore = store
+	app.HistorySize = 4
+
+	expect := func(msg string, entries ...string) {
+		if res := app.History(); !reflect.DeepEqual(res, entries) {
+			t.Errorf("App.History: got %q %s expected %q", res, msg, entries)
+		} else if !reflect.DeepEqual(store.Entries, entries) {
+			t.Errorf("MemoryHistory: got %q %s expected %q", store.Entries, msg, entries)
+		}
+	}
+
+	if err := app.LoadHistory(); err != nil {
+		t.Fatal("App.LoadHistory: got error:\n", err)
+	}
+
+	expect("after loading", "one", "two", "three")
+
+	app.AddHistory("four")
+	app.AddHistory("  ")
+	expect("after adding a blank line", "one", "two", "three", "four")
+
+	app.AddHistory("five")
+	expect("after exceeding HistorySize", "two", "three", "four", "five")
+
+	app.AddHistory(" secret")
+	expect("with a leading space", "three", "four", "five", " secret")
+
+	app.HistoryIgnoreSpace = true
+	app.AddHistory(" another secret")
+	expect("with a leading space and HistoryIgnoreSpace", "three", "four", "five", " secret")
+
+	app.AddHistory("four")
+	expect("with a duplicate", "four", "five", " secret", "four")
+
+	app.HistoryDedup = true
+	app.AddHistory("five")
+	expect("with a duplicate and HistoryDedup", "four", " secret", "four", "five")
+
+	app.AddHistory("four")
+	expect("with several duplicates and HistoryDedup", " secret", "five", "four")
+
+	if err := app.ClearHistory(); err != nil {
+		t.Error("App.ClearHistory: got error:\n", err)
+	}
+
+	if len(app.History()) != 0 || len(store.Entries) != 0 {
+		t.Errorf("App.ClearHistory: got %q and %q expected no entries", app.History(), store.Entries)
+	}
+
+	app.HistorySize = 2
+	store.Entries = []string{"one", "two", "three"}
+	if err := app.LoadHistory(); err != nil {
+		t.Error("App.LoadHistory: got error:\n", err)
+	} else if res := app.History(); !reflect.DeepEqual(res, []string{"two", "three"}) {
+		t.Errorf("App.LoadHistory: got %q with more entries than HistorySize expected 'two' and 'three'", res)
+	}
+}
+
+// TestFileHistory ensures that history is kept within the file at
+// HistoryFile.
+func TestFileHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestFileHistory")
+	if err != nil {
+		t.Fatal("ioutil.TempDir: got error:\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	app := NewApp("TestFileHistory", false)
+	app.HistoryFile = filepath.Join(dir, "history")
+
+	if err := app.LoadHistory(); err != nil {
+		t.Error("App.LoadHistory: got error with non-existent file:\n", err)
+	}
+
+	app.AddHistory("one")
+	app.AddHistory("two 'words'")
+
+	if data, err := ioutil.ReadFile(app.HistoryFile); err != nil {
+		t.Error("ioutil.ReadFile: got error:\n", err)
+	} else if string(data) != "one\ntwo 'words'\n" {
+		t.Errorf("App.AddHistory: got file contents %q expected %q", data, "one\ntwo 'words'\n")
+	}
+
+	other := NewApp("TestFileHistory", false)
+	other.HistoryFile = app.HistoryFile
+	if err := other.LoadHistory(); err != nil {
+		t.Error("App.LoadHistory: got error:\n", err)
+	} else if res := other.History(); !reflect.DeepEqual(res, []string{"one", "two 'words'"}) {
+		t.Errorf("App.LoadHistory: got %q expected 'one' and 'two 'words''", res)
+	}
+
+	other.HistoryFile = dir
+	if err := other.LoadHistory(); err == nil {
+		t.Error("App.LoadHistory: expected error with directory")
+	}
+}
+
+// TestExpandHistory ensures that references to history entries are expanded
+// outside of single quotes.
+func TestExpandHistory(t *testing.T) {
+	app := NewApp("TestExpandHistory", false)
+	for _, entry := range []string{"emit one", "upper two", "emit three"} {
+		app.AddHistory(entry)
+	}
+
+	expect := func(input, result string) {
+		if res, err := app.ExpandHistory(input); err != nil {
+			t.Errorf("App.ExpandHistory: got error with input `%s`:\n%s", input, err)
+		} else if res != result {
+			t.Errorf("App.ExpandHistory: got `%s` with input `%s` expected `%s`", res, input, result)
+		}
+	}
+
+	expect("!!", "emit three")
+	expect("!! | !up", "emit three | upper two")
+	expect("!1;!2", "emit one;upper two")
+	expect("!em", "emit three")
+	expect(`emit "!1"`, `emit "emit one"`)
+	expect("emit '!!'", "emit '!!'")
+	expect(`emit \!!`, `emit \!!`)
+	expect("emit ! '!'", "emit ! '!'")
+	expect("emit !", "emit !")
+	expect("test a != b", "test a != b")
+	expect("emit !(a)", "emit !(a)")
+	expect("!em=x", "emit three=x")
+	expect("nothing here", "nothing here")
+
+	expectError := func(input, event string) {
+		if _, err := app.ExpandHistory(input); err == nil {
+			t.Errorf("App.ExpandHistory: expected error with input `%s`", input)
+		} else if val, ok := err.(*ErrNoEvent); !ok || val.Event != event {
+			t.Errorf("App.ExpandHistory: expected error of type *ErrNoEvent with event '%s' got:\n%s", event, err)
+		}
+	}
+
+	expectError("!4", "!4")
+	expectError("!0", "!0")
+	expectError("emit !missing", "!missing")
+
+	app.ClearHistory()
+	expectError("!!", "!!")
+}
+
+// TestHistoryCommand tests the default top-level history command and history
+// expansion within Main.
+func TestHistoryCommand(t *testing.T) {
+	store := &MemoryHistory{Entries: []string{"help exit", "set a=1"}}
+	app := NewApp("TestHistoryCommand", true)
+	app.HistoryStore = store
+
+	MainInput(t, app, "history", "history", "    1  help exit\n    2  set a=1\n    3  history\n")
+	MainInput(t, app, "history with text", "history exit", "    1  help exit\n", "")
+	MainInput(t, app, "history expansion", "!1", "help exit\nexit [-shell-only]")
+	MainInput(t, app, "history expansion with non-existent entry", "!99", "!99: event not found")
+	MainInput(t, app, "history with too many arguments", "history a b", "history [-clear] [<text>]")
+
+	if res := store.Entries[len(store.Entries)-3:]; !reflect.DeepEqual(res, []string{"history exit", "help exit",
+		"history a b"}) {
+		t.Errorf("App.Main: got history entries %q expected expanded lines", res)
+	}
+
+	MainInput(t, app, "history with clear", "history -clear")
+	if len(store.Entries) != 0 {
+		t.Errorf("history -clear: got history entries %q expected none", store.Entries)
+	}
+}
@@ -0,0 +1,222 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Job is a list of pipelines run in the background, as started by ending it
+// with '&'. Its output and error output are buffered until it is brought to
+// the foreground with the default fg command, waited for with the default
+// wait command, or announced by Main once it has finished.
+type Job struct {
+	// ID is the number by which the job is referred to, one greater than that
+	// of the most recent job still in the App's job table.
+	ID int
+
+	// Input is the part of the input which the job runs, without the '&'.
+	Input string
+
+	// output holds the output and error output of the job.
+	output *jobOutput
+
+	// cancel cancels the context.Context of each command run by the job.
+	cancel context.CancelFunc
+
+	// done is closed once the job has finished, after which status and err
+	// hold its result.
+	done   chan struct{}
+	status ExitStatus
+	err    error
+}
+
+// Done returns true if the job has finished.
+func (job *Job) Done() bool {
+	select {
+	case <-job.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the job has finished and returns the ExitStatus and error
+// of the last pipeline which it ran.
+func (job *Job) Wait() (ExitStatus, error) {
+	<-job.done
+	return job.status, job.err
+}
+
+// Kill cancels the context.Context of each command run by the job. The job
+// finishes once its current command returns, and no further pipelines are run.
+func (job *Job) Kill() {
+	job.cancel()
+}
+
+// state returns a short description of the state of the job, as listed by the
+// default jobs command.
+func (job *Job) state() string {
+	if !job.Done() {
+		return "running"
+	}
+
+	if code := ExitCode(job.Wait()); code != 0 {
+		return "exit " + strconv.Itoa(code)
+	}
+
+	return "done"
+}
+
+// jobOutput buffers the output of a job until it is attached to a writer.
+type jobOutput struct {
+	buffer bytes.Buffer
+	target io.Writer
+	mutex  sync.Mutex
+}
+
+// Write implements io.Writer for jobOutput.
+func (out *jobOutput) Write(data []byte) (int, error) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if out.target != nil {
+		return out.target.Write(data)
+	}
+
+	return out.buffer.Write(data)
+}
+
+// attach writes any buffered output to the writer provided and passes all
+// further output directly to it. If the writer is nil, output is once again
+// buffered.
+func (out *jobOutput) attach(target io.Writer) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if target != nil {
+		out.buffer.WriteTo(target)
+	}
+
+	out.target = target
+}
+
+// startJob takes the links of a list ended by '&' and runs them in the
+// background as a new job, which is added to the App's job table and printed
+// to the App's ErrOutput along with its ID. The job is not cancelled along with
+// the input which started it, but only if killed.
+func (app *App) startJob(links []*link) *Job {
+	first := links[0].stages[0][0]
+	lastStages := links[len(links)-1].stages
+	lastTokens := lastStages[len(lastStages)-1]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		Input:  first.input[first.pos:lastTokens[len(lastTokens)-1].end],
+		output: &jobOutput{},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	// the links are run within the job rather than as another job
+	foreground := make([]*link, 0, len(links))
+	for _, item := range links {
+		foreground = append(foreground, &link{op: item.op, stages: item.stages})
+	}
+
+	app.mutex.Lock()
+	job.ID = 1
+	if length := len(app.jobs); length > 0 {
+		job.ID = app.jobs[length-1].ID + 1
+	}
+
+	app.jobs = append(app.jobs, job)
+	app.mutex.Unlock()
+
+	fmt.Fprintf(app.ErrOutput, "[%d] %s\n", job.ID, job.Input)
+
+	go func() {
+		defer cancel()
+
+		job.status, job.err = app.runChain(ctx, foreground, job.output, job.output, nil)
+		close(job.done)
+	}()
+
+	return job
+}
+
+// Jobs returns all jobs in the App's job table, ordered by ID. A job remains in
+// the table until it has finished and been announced by Main or brought to the
+// foreground or waited for with the default fg or wait command.
+func (app *App) Jobs() []*Job {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	return append([]*Job{}, app.jobs...)
+}
+
+// Job returns a job in the App's job table by ID and whether it exists.
+func (app *App) Job(id int) (*Job, bool) {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	for _, job := range app.jobs {
+		if job.ID == id {
+			return job, true
+		}
+	}
+
+	return nil, false
+}
+
+// findJob takes a reference to a job in the form n or %n, as accepted by the
+// default job commands, and returns the job and whether it exists.
+func (app *App) findJob(ref string) (*Job, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(ref, "%"))
+	if err != nil {
+		return nil, false
+	}
+
+	return app.Job(id)
+}
+
+// removeJob removes a job from the App's job table.
+func (app *App) removeJob(job *Job) {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	for key, item := range app.jobs {
+		if item == job {
+			app.jobs = append(app.jobs[:key], app.jobs[key+1:]...)
+			return
+		}
+	}
+}
+
+// reportJob takes a job which has finished and removes it from the App's job
+// table, writing any output which it buffered to output and printing its
+// state to errOutput, followed by its error if any.
+func (app *App) reportJob(job *Job, output, errOutput io.Writer) {
+	app.removeJob(job)
+	job.output.attach(output)
+
+	fmt.Fprintf(errOutput, "[%d] %s  %s\n", job.ID, job.state(), job.Input)
+	if _, err := job.Wait(); err != nil {
+		app.printError(errOutput, err)
+	}
+}
+
+// announceJobs reports each job which has finished as with reportJob, writing
+// its output and state to the App's Output and ErrOutput. It is called by
+// Main before each prompt.
+func (app *App) announceJobs() {
+	for _, job := range app.Jobs() {
+		if job.Done() {
+			app.reportJob(job, app.Output, app.ErrOutput)
+		}
+	}
+}
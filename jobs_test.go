@@ -0,0 +1,170 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBackgroundJobs ensures that lists ending with '&' are run as jobs whose
+// output is held until they are waited for or brought to the foreground.
+func TestBackgroundJobs(t *testing.T) {
+	WithPipeCommands(t, "TestBackgroundJobs", func(app *App, output *strings.Builder) {
+		if _, err := app.ExecuteString("emit one & emit two"); err != nil {
+			t.Fatal("App.ExecuteString: got error with job:\n", err)
+		} else if res := output.String(); res != "[1] emit one\ntwo\n" {
+			t.Errorf("App.ExecuteString: got output %q with job", res)
+		}
+
+		jobs := app.Jobs()
+		if len(jobs) != 1 || jobs[0].ID != 1 || jobs[0].Input != "emit one" {
+			t.Fatalf("App.Jobs: got %d jobs expected 'emit one' with ID 1", len(jobs))
+		}
+
+		if status, err := jobs[0].Wait(); status != ExitCmd || err != nil {
+			t.Errorf("Job.Wait: got ExitStatus %d and error %v", status, err)
+		} else if job, ok := app.Job(1); !ok || job != jobs[0] {
+			t.Error("App.Job: expected finished job to remain until reported")
+		}
+
+		output.Reset()
+		if _, err := app.ExecuteString("wait"); err != nil {
+			t.Error("App.ExecuteString: got error with wait:\n", err)
+		} else if res := output.String(); res != "one\n[1] done  emit one\n" {
+			t.Errorf("wait: got output %q", res)
+		} else if len(app.Jobs()) != 0 {
+			t.Error("wait: expected job to be removed")
+		}
+
+		output.Reset()
+		app.ExecuteString("fail || emit recovered && emit again & emit b &")
+		if jobs := app.Jobs(); len(jobs) != 2 {
+			t.Fatalf("App.Jobs: got %d jobs expected 2", len(jobs))
+		} else if jobs[0].Input != "fail || emit recovered && emit again" || jobs[1].Input != "emit b" {
+			t.Errorf("App.Jobs: got inputs '%s' and '%s'", jobs[0].Input, jobs[1].Input)
+		} else if jobs[1].ID != 2 {
+			t.Errorf("App.Jobs: got ID %d for second job expected 2", jobs[1].ID)
+		}
+
+		output.Reset()
+		app.ExecuteString("fg 1")
+		if res := output.String(); !strings.Contains(res, "recovered\nagain\n") || strings.Contains(res, "b\n") {
+			t.Errorf("fg: got output %q", res)
+		}
+
+		output.Reset()
+		app.ExecuteString("fg")
+		if res := output.String(); res != "emit b\nb\n" {
+			t.Errorf("fg: got output %q for most recent job", res)
+		} else if len(app.Jobs()) != 0 {
+			t.Error("fg: expected jobs to be removed")
+		}
+
+		output.Reset()
+		app.ExecuteString("nothing &")
+		app.ExecuteString("wait %1")
+		if res := output.String(); !strings.Contains(res, "[1] exit 127  nothing\nnothing: command not found") {
+			t.Errorf("wait: got output %q for failed job", res)
+		}
+
+		// errors from earlier pipelines of a job are held along with its output
+		output.Reset()
+		app.ExecuteString("nothing && emit a || emit after &")
+		if jobs := app.Jobs(); len(jobs) != 1 {
+			t.Fatalf("App.Jobs: got %d jobs expected 1", len(jobs))
+		} else if jobs[0].Wait(); output.String() != "[1] nothing && emit a || emit after\n" {
+			t.Errorf("App.ExecuteString: got output %q before job was brought to the foreground", output.String())
+		}
+
+		output.Reset()
+		app.ExecuteString("fg")
+		if res := output.String(); res != "nothing && emit a || emit after\nnothing: command not found\nafter\n" {
+			t.Errorf("fg: got output %q for job with failed pipeline", res)
+		}
+
+		// the state and error of a job follow the redirection of fg and wait
+		dir, err := ioutil.TempDir("", "TestBackgroundJobs")
+		if err != nil {
+			t.Fatal("ioutil.TempDir: got error:\n", err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, cmd := range []string{"wait", "fg"} {
+			path := filepath.Join(dir, cmd+".txt")
+			app.ExecuteString("nothing &")
+			output.Reset()
+			app.ExecuteString(cmd + " 2> " + path)
+
+			if res, err := ioutil.ReadFile(path); err != nil {
+				t.Error("ioutil.ReadFile: got error:\n", err)
+			} else if !strings.Contains(string(res), "nothing: command not found\n") {
+				t.Errorf("%s: expected error of job within redirected error output, got %q", cmd, res)
+			} else if strings.Contains(output.String(), "command not found") {
+				t.Errorf("%s: expected no error of job within error output, got %q", cmd, output.String())
+			}
+		}
+
+		for _, input := range []string{"&", "emit a & & emit b", "& emit a"} {
+			if _, err := app.ExecuteString(input); err == nil {
+				t.Errorf("App.ExecuteString: expected error with input '%s'", input)
+			} else if _, ok := err.(*ErrParseInput); !ok {
+				t.Errorf("App.ExecuteString: expected error of type *ErrParseInput with input '%s':\n%s", input, err)
+			}
+		}
+
+		output.Reset()
+		app.ExecuteString("fg 4; wait 4; kill %4")
+		if res := output.String(); strings.Count(res, "4: no such job") != 3 || !strings.Contains(res, "%4: no such job") {
+			t.Errorf("job commands: got output %q for non-existent job", res)
+		}
+	})
+}
+
+// TestKillJob ensures that jobs may be listed and killed.
+func TestKillJob(t *testing.T) {
+	app := NewApp("TestKillJob", true)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+
+	started := make(chan bool, 1)
+	if err := app.AddCommand(Command{
+		Name: "block",
+		Main: func(ctx *Context) ExitStatus {
+			started <- true
+			<-ctx.Context().Done()
+			ctx.Println("cancelled")
+			return ExitCmd
+		},
+	}); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	app.ExecuteString("block && block &")
+	<-started
+	jobs := app.Jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("App.Jobs: got %d jobs expected 1", len(jobs))
+	} else if jobs[0].Done() {
+		t.Error("Job.Done: expected blocked job to be running")
+	}
+
+	output.Reset()
+	app.ExecuteString("jobs")
+	if res := output.String(); res != "[1] running  block && block\n" {
+		t.Errorf("jobs: got output %q", res)
+	}
+
+	app.ExecuteString("kill 1")
+	if _, err := jobs[0].Wait(); err != context.Canceled {
+		t.Errorf("Job.Wait: got error %v after kill expected context.Canceled", err)
+	}
+
+	MainInput(t, app, "finished job", "jobs", "cancelled\n", "[1] exit 1  block && block\ninterrupted")
+	if len(app.Jobs()) != 0 {
+		t.Error("App.Main: expected finished job to be removed once announced")
+	}
+}
@@ -0,0 +1,533 @@
+package shell
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind identifies the type of a token produced by the lexer.
+type tokenKind int
+
+const (
+	// tokenWord is a plain word such as a command name or an argument.
+	tokenWord tokenKind = iota
+
+	// tokenPipe is an unquoted '|' connecting the output of one command to the
+	// input of the next.
+	tokenPipe
+
+	// tokenSequence is an unquoted ';' separating two pipelines, the second of
+	// which is run unconditionally.
+	tokenSequence
+
+	// tokenAnd is an unquoted '&&' separating two pipelines, the second of
+	// which is run only if the first succeeds.
+	tokenAnd
+
+	// tokenOr is an unquoted '||' separating two pipelines, the second of which
+	// is run only if the first fails.
+	tokenOr
+
+	// tokenBackground is an unquoted '&' ending a list of pipelines which is
+	// run in the background as a job.
+	tokenBackground
+
+	// tokenRedirectIn is an unquoted '<' replacing the input of a command with
+	// the file named by the following word.
+	tokenRedirectIn
+
+	// tokenRedirectOut is an unquoted '>' replacing the output of a command
+	// with the file named by the following word, truncating it if it exists.
+	tokenRedirectOut
+
+	// tokenRedirectAppend is an unquoted '>>' replacing the output of a
+	// command with the file named by the following word, appending to it if
+	// it exists.
+	tokenRedirectAppend
+
+	// tokenRedirectErr is an unquoted '2>' at the beginning of a word
+	// replacing the error output of a command with the file named by the
+	// following word, truncating it if it exists.
+	tokenRedirectErr
+)
+
+// isRedirect returns true if the token kind is a redirection operator.
+func (kind tokenKind) isRedirect() bool {
+	switch kind {
+	case tokenRedirectIn, tokenRedirectOut, tokenRedirectAppend, tokenRedirectErr:
+		return true
+	}
+
+	return false
+}
+
+// operators maps unquoted operator strings to their token kinds. Operators
+// need not be surrounded by whitespace to be recognized, however those
+// beginning with a digit are only recognized at the beginning of a word.
+var operators = map[string]tokenKind{
+	"|":  tokenPipe,
+	";":  tokenSequence,
+	"&&": tokenAnd,
+	"||": tokenOr,
+	"&":  tokenBackground,
+	"<":  tokenRedirectIn,
+	">":  tokenRedirectOut,
+	">>": tokenRedirectAppend,
+	"2>": tokenRedirectErr,
+}
+
+// token is a single unit of user input as produced by the lexer.
+type token struct {
+	// kind is the type of the token.
+	kind tokenKind
+
+	// value is the text of the token with all quotes and escapes removed.
+	value string
+
+	// pos is the byte offset within the input at which the token begins.
+	pos int
+
+	// end is the byte offset within the input immediately following the
+	// token.
+	end int
+
+	// input is the complete input from which the token was read.
+	input string
+}
+
+// lexer splits a string of user input into tokens. It should not be used
+// directly, instead tokenize should be utilized.
+type lexer struct {
+	// input is the complete string being split.
+	input string
+
+	// pos is the byte offset of the next character to be read.
+	pos int
+
+	// expander provides the values of variables and command substitutions. If
+	// nil, neither is expanded.
+	expander expander
+}
+
+// expander provides the lexer with the values of variables and command
+// substitutions.
+type expander interface {
+	// lookupVariable returns the value of a variable by name, or an empty
+	// string if it does not exist.
+	lookupVariable(name string) string
+
+	// substituteCommand executes the input provided and returns its output.
+	substituteCommand(input string) (string, error)
+}
+
+// tokenize takes a string of user input and splits it into tokens. Words are
+// separated by unquoted whitespace. Single quotes preserve the literal value
+// of every character within them. Double quotes do the same, except that a
+// backslash may be used to escape a double quote, a '$', or another backslash
+// and that variables are expanded. Outside of quotes, a backslash preserves the
+// literal value of the next character.
+// Unquoted operators such as '|' are returned as separate tokens. An
+// ErrParseInput is returned if a quote is not terminated or the input ends
+// with a backslash.
+//
+// Variables and command substitutions are not expanded by tokenize, since
+// their values may change as each command is run. Instead, expandWord should
+// be used on each word token immediately before it is needed.
+func tokenize(input string) ([]token, error) {
+	lex := &lexer{input: input}
+	tokens := make([]token, 0)
+
+	for {
+		tok, err := lex.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok == nil {
+			return tokens, nil
+		}
+
+		tokens = append(tokens, *tok)
+	}
+}
+
+// matchOperator checks whether an operator begins at the current position,
+// returning its length and kind. The longest matching operator is preferred.
+// If none matches, a length of 0 is returned.
+func (lex *lexer) matchOperator() (int, tokenKind) {
+	length, kind := 0, tokenWord
+	for op, opKind := range operators {
+		if len(op) > length && strings.HasPrefix(lex.input[lex.pos:], op) {
+			length, kind = len(op), opKind
+		}
+	}
+	return length, kind
+}
+
+// expandWord takes a word token and returns the fields produced by reading it
+// again from its input with variables and command substitutions expanded by
+// the expander. Outside of single quotes, variable references in the form
+// $NAME or ${NAME} are replaced with the value of the variable and command
+// substitutions in the form $(input) with the output of the command, less any
+// trailing newlines. Unquoted values are split into several fields at any
+// whitespace they contain, and a word which expands to nothing produces no
+// fields at all. An ErrParseInput is returned if a reference is invalid, while
+// any error from a command substitution is returned as is.
+func expandWord(tok token, exp expander) ([]string, error) {
+	lex := &lexer{input: tok.input, pos: tok.pos, expander: exp}
+	return lex.readWord()
+}
+
+// quote returns the string surrounded by single quotes such that it would be
+// read by the lexer as a single word with exactly the same value.
+func quote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// errorAt returns an ErrParseInput for the lexer's input at the position
+// provided.
+func (lex *lexer) errorAt(pos int, reason string) error {
+	return &ErrParseInput{Input: lex.input, Position: pos, Reason: reason}
+}
+
+// peek returns the next rune and its size without consuming it. If no input
+// remains, a size of 0 is returned.
+func (lex *lexer) peek() (rune, int) {
+	if lex.pos >= len(lex.input) {
+		return 0, 0
+	}
+
+	return utf8.DecodeRuneInString(lex.input[lex.pos:])
+}
+
+// skipSpace consumes any whitespace at the current position.
+func (lex *lexer) skipSpace() {
+	for {
+		char, size := lex.peek()
+		if size == 0 || !unicode.IsSpace(char) {
+			return
+		}
+
+		lex.pos += size
+	}
+}
+
+// word accumulates the fields produced while reading a single word of input.
+// A word usually produces a single field, but the unquoted expansion of a
+// variable is split into several at any whitespace it contains and may also
+// produce none.
+type word struct {
+	// fields holds each completed field.
+	fields []string
+
+	// current holds the field being read.
+	current strings.Builder
+
+	// started is true if the current field should be kept even if it is
+	// empty, such as when it contains an empty pair of quotes.
+	started bool
+}
+
+// writeRune writes a literal rune to the current field.
+func (w *word) writeRune(char rune) {
+	w.current.WriteRune(char)
+	w.started = true
+}
+
+// writeString writes a literal string to the current field.
+func (w *word) writeString(str string) {
+	w.current.WriteString(str)
+	w.started = true
+}
+
+// writeSplit writes a string to the current field, beginning a new field at
+// each sequence of whitespace.
+func (w *word) writeSplit(str string) {
+	for _, char := range str {
+		if !unicode.IsSpace(char) {
+			w.writeRune(char)
+		} else if w.started {
+			w.finish()
+		}
+	}
+}
+
+// finish completes the current field if it has been started.
+func (w *word) finish() {
+	if w.started {
+		w.fields = append(w.fields, w.current.String())
+	}
+
+	w.current.Reset()
+	w.started = false
+}
+
+// next reads and returns the next token, or nil if no input remains.
+// Variables within words are not expanded.
+func (lex *lexer) next() (*token, error) {
+	lex.skipSpace()
+	if lex.pos >= len(lex.input) {
+		return nil, nil
+	}
+
+	start := lex.pos
+	if length, kind := lex.matchOperator(); length > 0 {
+		lex.pos += length
+		return &token{kind: kind, value: lex.input[start:lex.pos], pos: start, end: lex.pos, input: lex.input}, nil
+	}
+
+	fields, err := lex.readWord()
+	if err != nil {
+		return nil, err
+	}
+
+	// without an expander a word always produces a single field
+	return &token{kind: tokenWord, value: fields[0], pos: start, end: lex.pos, input: lex.input}, nil
+}
+
+// readWord consumes a word beginning at the current position and returns the
+// fields which it produces.
+func (lex *lexer) readWord() ([]string, error) {
+	current := &word{}
+
+	for {
+		char, size := lex.peek()
+		if size == 0 || unicode.IsSpace(char) {
+			break
+		}
+
+		// an unquoted operator terminates the word
+		if length, _ := lex.matchOperator(); length > 0 && !unicode.IsDigit(char) {
+			break
+		}
+
+		switch char {
+		case '\\':
+			lex.pos += size
+			escaped, escapedSize := lex.peek()
+			if escapedSize == 0 {
+				return nil, lex.errorAt(lex.pos-size, "unterminated escape sequence")
+			}
+
+			current.writeRune(escaped)
+			lex.pos += escapedSize
+		case '\'':
+			if err := lex.readSingleQuoted(current); err != nil {
+				return nil, err
+			}
+		case '"':
+			if err := lex.readDoubleQuoted(current); err != nil {
+				return nil, err
+			}
+		case '$':
+			value, err := lex.readExpansion()
+			if err != nil {
+				return nil, err
+			}
+
+			// without an expander the value is literal and must not be split
+			if lex.expander == nil {
+				current.writeString(value)
+			} else {
+				current.writeSplit(value)
+			}
+		default:
+			current.writeRune(char)
+			lex.pos += size
+		}
+	}
+
+	current.finish()
+	return current.fields, nil
+}
+
+// readSingleQuoted consumes a single-quoted string beginning at the current
+// position and writes its contents to the word.
+func (lex *lexer) readSingleQuoted(current *word) error {
+	start := lex.pos
+	lex.pos++ // Skip opening quote
+
+	end := strings.IndexByte(lex.input[lex.pos:], '\'')
+	if end == -1 {
+		return lex.errorAt(start, "unterminated single quote")
+	}
+
+	current.writeString(lex.input[lex.pos : lex.pos+end])
+	lex.pos += end + 1
+
+	return nil
+}
+
+// readDoubleQuoted consumes a double-quoted string beginning at the current
+// position and writes its contents to the word. Variables and command
+// substitutions within are expanded but not split.
+func (lex *lexer) readDoubleQuoted(current *word) error {
+	start := lex.pos
+	lex.pos++ // Skip opening quote
+	current.writeString("")
+
+	for {
+		char, size := lex.peek()
+		if size == 0 {
+			return lex.errorAt(start, "unterminated double quote")
+		}
+
+		switch char {
+		case '"':
+			lex.pos += size
+			return nil
+		case '$':
+			value, err := lex.readExpansion()
+			if err != nil {
+				return err
+			}
+
+			current.writeString(value)
+			continue
+		}
+
+		lex.pos += size
+
+		if char == '\\' {
+			// a backslash only escapes characters with special meaning
+			if escaped, escapedSize := lex.peek(); escaped == '"' || escaped == '\\' || escaped == '$' {
+				current.writeRune(escaped)
+				lex.pos += escapedSize
+				continue
+			}
+		}
+
+		current.writeRune(char)
+	}
+}
+
+// isNameChar returns true if the rune may appear in a variable name. Names
+// may not begin with a digit.
+func isNameChar(char rune, first bool) bool {
+	return char == '_' || unicode.IsLetter(char) || (!first && unicode.IsDigit(char))
+}
+
+// readExpansion consumes either a command substitution or a reference to a
+// variable beginning with a '$' at the current position and returns its value.
+func (lex *lexer) readExpansion() (string, error) {
+	if strings.HasPrefix(lex.input[lex.pos:], "$(") {
+		return lex.readSubstitution()
+	}
+
+	return lex.readVariable()
+}
+
+// readSubstitution consumes a command substitution in the form $(input)
+// beginning at the current position and returns the output of the command
+// with any trailing newlines removed. The input may contain quotes and nested
+// substitutions. If the lexer has no expander, the substitution is returned
+// literally.
+func (lex *lexer) readSubstitution() (string, error) {
+	start := lex.pos
+	scan := &lexer{input: lex.input, pos: lex.pos + 2} // Skip '$('
+	discard := &word{}
+
+	for depth := 1; depth > 0; {
+		char, size := scan.peek()
+		if size == 0 {
+			return "", lex.errorAt(start, "unterminated command substitution")
+		}
+
+		switch char {
+		case '\\':
+			scan.pos += size
+			_, size = scan.peek()
+			scan.pos += size
+		case '\'':
+			if err := scan.readSingleQuoted(discard); err != nil {
+				return "", err
+			}
+		case '"':
+			if err := scan.readDoubleQuoted(discard); err != nil {
+				return "", err
+			}
+		case '(':
+			depth++
+			scan.pos += size
+		case ')':
+			depth--
+			scan.pos += size
+		default:
+			scan.pos += size
+		}
+	}
+
+	lex.pos = scan.pos
+	if lex.expander == nil {
+		return lex.input[start:lex.pos], nil
+	}
+
+	output, err := lex.expander.substituteCommand(lex.input[start+2 : lex.pos-1])
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(output, "\n"), nil
+}
+
+// readVariable consumes a reference to a variable in the form $NAME or
+// ${NAME} beginning at the current position and returns its value. If the
+// lexer has no expander or the '$' is not followed by a name, the '$' is
+// returned literally.
+func (lex *lexer) readVariable() (string, error) {
+	start := lex.pos
+	lex.pos++ // Skip '$'
+
+	if lex.expander == nil {
+		return "$", nil
+	}
+
+	if strings.HasPrefix(lex.input[lex.pos:], "{") {
+		end := strings.IndexByte(lex.input[lex.pos:], '}')
+		if end == -1 {
+			return "", lex.errorAt(start, "unterminated variable reference")
+		}
+
+		name := lex.input[lex.pos+1 : lex.pos+end]
+		if !isValidName(name) {
+			return "", lex.errorAt(start, "invalid variable name '"+name+"'")
+		}
+
+		lex.pos += end + 1
+		return lex.expander.lookupVariable(name), nil
+	}
+
+	nameStart := lex.pos
+	for {
+		char, size := lex.peek()
+		if size == 0 || !isNameChar(char, lex.pos == nameStart) {
+			break
+		}
+
+		lex.pos += size
+	}
+
+	if lex.pos == nameStart {
+		return "$", nil
+	}
+
+	return lex.expander.lookupVariable(lex.input[nameStart:lex.pos]), nil
+}
+
+// isValidName returns true if the string is a valid variable name. Names must
+// not be empty, may contain only letters, digits, and underscores, and may not
+// begin with a digit.
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for key, char := range name {
+		if !isNameChar(char, key == 0) {
+			return false
+		}
+	}
+
+	return true
+}
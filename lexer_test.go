@@ -0,0 +1,81 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTokenize ensures that input is split as expected with a variety of
+// quotes and escapes.
+func TestTokenize(t *testing.T) {
+	expect := func(input string, values ...string) {
+		tokens, err := tokenize(input)
+		if err != nil {
+			t.Errorf("tokenize: got error with input `%s`:\n%s", input, err)
+		} else if res := tokenValues(tokens); (len(res) > 0 || len(values) > 0) && !reflect.DeepEqual(res, values) {
+			t.Errorf("tokenize: got %q with input `%s` expected %q", res, input, values)
+		}
+	}
+
+	expect("")
+	expect("   ")
+	expect("note add milk", "note", "add", "milk")
+	expect("  note\tadd  ", "note", "add")
+	expect(`note add "buy milk"`, "note", "add", "buy milk")
+	expect(`note add 'buy "oat" milk'`, "note", "add", `buy "oat" milk`)
+	expect(`note add buy\ milk`, "note", "add", "buy milk")
+	expect(`"a b"'c d'e`, "a bc de")
+	expect(`"say \"hi\" \\ \n"`, `say "hi" \ \n`)
+	expect(`'no \escapes'`, `no \escapes`)
+	expect(`empty "" ''`, "empty", "", "")
+	expect("ünïcode 'wörds'", "ünïcode", "wörds")
+	expect("a|b | 'c|d' \\|", "a", "|", "b", "|", "c|d", "|")
+	expect("a;b&&c||d | e", "a", ";", "b", "&&", "c", "||", "d", "|", "e")
+	expect(`a "&&" b\;`, "a", "&&", "b;")
+	expect("a&b && c &", "a", "&", "b", "&&", "c", "&")
+	expect(`a $(b c | "d)") "$(e)"`, "a", `$(b c | "d)")`, "$(e)")
+	expect("a <in >out >>log 2>err a2>b", "a", "<", "in", ">", "out", ">>", "log", "2>", "err", "a2", ">", "b")
+}
+
+// TestQuote ensures that quoted strings are read back as a single word with
+// the same value.
+func TestQuote(t *testing.T) {
+	for _, str := range []string{"", "plain", "with space", `it's "quoted" \ $var`, "a | b; c"} {
+		if tokens, err := tokenize(quote(str)); err != nil {
+			t.Errorf("quote: got error reading quoted string %q:\n%s", str, err)
+		} else if len(tokens) != 1 || tokens[0].value != str {
+			t.Errorf("quote: got tokens %q reading quoted string %q", tokenValues(tokens), str)
+		}
+	}
+}
+
+// TestTokenizeErrors ensures that an ErrParseInput containing the correct
+// position is returned with invalid input.
+func TestTokenizeErrors(t *testing.T) {
+	expect := func(input string, pos int, reason string) {
+		if _, err := tokenize(input); err == nil {
+			t.Errorf("tokenize: expected error with input `%s`", input)
+		} else if val, ok := err.(*ErrParseInput); !ok {
+			t.Errorf("tokenize: expected error of type *ErrParseInput with input `%s`:\n%s", input, err)
+		} else if val.Position != pos || val.Reason != reason {
+			t.Errorf("tokenize: got position %d and reason '%s' with input `%s` expected %d and '%s'",
+				val.Position, val.Reason, input, pos, reason)
+		}
+	}
+
+	expect(`note add "buy milk`, 9, "unterminated double quote")
+	expect(`note add 'buy milk`, 9, "unterminated single quote")
+	expect(`note add milk\`, 13, "unterminated escape sequence")
+	expect(`"it's`, 0, "unterminated double quote")
+	expect(`a $(b (c)`, 2, "unterminated command substitution")
+	expect(`a "$(b"`, 6, "unterminated double quote")
+}
+
+// tokenValues takes a list of tokens and returns their values.
+func tokenValues(tokens []token) []string {
+	values := make([]string, len(tokens))
+	for key, tok := range tokens {
+		values[key] = tok.value
+	}
+	return values
+}
@@ -0,0 +1,124 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bindOptions takes a Context and the Options of a command, which must be a
+// pointer to a struct, and returns a pointer to a fresh copy of the struct
+// with each of its tagged fields registered as a flag with the FlagSet of the
+// Context. Fields are registered in the order in which they are declared, and
+// only those which are exported and tagged with `flag:"name"` are registered.
+// The field's value is used as the default value of the flag unless it is
+// tagged with `default:"value"`, and the flag is described by the
+// `usage:"text"` tag. A short name for use with GNUFlags may be set with the
+// `short:"n"` tag, the values allowed with the `choices:"a|b|c"` tag as with
+// Context.SetFlagChoices, and whether the flag is required with the
+// `required:"true"` tag as with Context.RequireFlag.
+//
+// Fields may be of type string, bool, int, int64, uint, uint64, float64, or
+// time.Duration, or of any type whose pointer implements flag.Value. An error
+// is returned if a field is of any other type, if its default value cannot be
+// parsed, or if its flag name is invalid or already registered.
+func bindOptions(ctx *Context, options interface{}) (interface{}, error) {
+	flags := ctx.FlagSet()
+	value := reflect.ValueOf(options)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Options must be a pointer to a struct, got %T", options)
+	}
+
+	fresh := reflect.New(value.Elem().Type())
+	fresh.Elem().Set(value.Elem())
+
+	structType := fresh.Elem().Type()
+	for key := 0; key < structType.NumField(); key++ {
+		field := structType.Field(key)
+		name := field.Tag.Get("flag")
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if strings.HasPrefix(name, "-") || strings.Contains(name, "=") {
+			return nil, fmt.Errorf("field '%s' has an invalid flag name '%s'", field.Name, name)
+		}
+
+		if flags.Lookup(name) != nil {
+			return nil, fmt.Errorf("field '%s' redefines flag '%s'", field.Name, name)
+		}
+
+		ptr := fresh.Elem().Field(key).Addr().Interface()
+		usage := field.Tag.Get("usage")
+
+		// parse any default value into the field so that it is used by the flag
+		if def, ok := field.Tag.Lookup("default"); ok {
+			defaults := flag.NewFlagSet(name, flag.ContinueOnError)
+			if defineFlag(defaults, ptr, name, usage) {
+				if err := defaults.Set(name, def); err != nil {
+					return nil, fmt.Errorf("field '%s' has an invalid default value '%s':\n%s", field.Name, def, err)
+				}
+			}
+		}
+
+		if !defineFlag(flags, ptr, name, usage) {
+			return nil, fmt.Errorf("field '%s' has unsupported type %s", field.Name, field.Type)
+		}
+
+		if short, ok := field.Tag.Lookup("short"); ok {
+			if len([]rune(short)) != 1 || short == "-" || short == "=" {
+				return nil, fmt.Errorf("field '%s' has an invalid short name '%s'", field.Name, short)
+			}
+
+			ctx.SetShortFlag(short, name)
+		}
+
+		if choices, ok := field.Tag.Lookup("choices"); ok {
+			ctx.SetFlagChoices(name, strings.Split(choices, "|")...)
+		}
+
+		if required, ok := field.Tag.Lookup("required"); ok {
+			if isRequired, err := strconv.ParseBool(required); err != nil {
+				return nil, fmt.Errorf("field '%s' has an invalid required tag '%s'", field.Name, required)
+			} else if isRequired {
+				ctx.RequireFlag(name)
+			}
+		}
+	}
+
+	return fresh.Interface(), nil
+}
+
+// defineFlag takes a FlagSet, a pointer to a value, and the name and usage of
+// a flag, and registers the flag such that its value is stored at the pointer
+// with the current value as its default. False is returned if the pointer is
+// of an unsupported type.
+func defineFlag(flags *flag.FlagSet, ptr interface{}, name, usage string) bool {
+	switch ptr := ptr.(type) {
+	case flag.Value:
+		flags.Var(ptr, name, usage)
+	case *string:
+		flags.StringVar(ptr, name, *ptr, usage)
+	case *bool:
+		flags.BoolVar(ptr, name, *ptr, usage)
+	case *int:
+		flags.IntVar(ptr, name, *ptr, usage)
+	case *int64:
+		flags.Int64Var(ptr, name, *ptr, usage)
+	case *uint:
+		flags.UintVar(ptr, name, *ptr, usage)
+	case *uint64:
+		flags.Uint64Var(ptr, name, *ptr, usage)
+	case *float64:
+		flags.Float64Var(ptr, name, *ptr, usage)
+	case *time.Duration:
+		flags.DurationVar(ptr, name, *ptr, usage)
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,123 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// level is a flag.Value used to ensure that Options fields of custom types are
+// bound.
+type level int
+
+// String implements flag.Value for level.
+func (lvl *level) String() string {
+	return strings.Repeat("v", int(*lvl))
+}
+
+// Set implements flag.Value for level.
+func (lvl *level) Set(value string) error {
+	*lvl = level(len(value))
+	return nil
+}
+
+// deployOptions is used as the Options of TmplOptionsCmd.
+type deployOptions struct {
+	Env     string        `flag:"env" default:"dev" usage:"environment to deploy to"`
+	Force   bool          `flag:"force" usage:"deploy even if checks fail"`
+	Count   int           `flag:"count" default:"1" usage:"number of instances"`
+	Wait    time.Duration `flag:"wait" usage:"time to wait between instances"`
+	Verbose level         `flag:"v" usage:"verbosity"`
+	Ignored string
+	hidden  string `flag:"hidden"`
+}
+
+// TmplOptionsCmd is used to ensure that Options are bound to flags.
+var TmplOptionsCmd = Command{
+	Name:    "deploy",
+	Usage:   "${name} ${shortFlags}:\n\n${flags}",
+	Options: &deployOptions{Wait: time.Second, Ignored: "kept"},
+	Main: func(ctx *Context) ExitStatus {
+		options := ctx.Options().(*deployOptions)
+		ctx.Printf("%s %t %d %s %d %s\n", options.Env, options.Force, options.Count, options.Wait, options.Verbose,
+			options.Ignored)
+		return ExitCmd
+	},
+}
+
+// TestOptions ensures that a fresh copy of a command's Options is filled by
+// parsing flags each time it is executed.
+func TestOptions(t *testing.T) {
+	app := NewApp("TestOptions", false)
+	output := &strings.Builder{}
+	app.Output = output
+	app.ErrOutput = output
+
+	if err := app.AddCommand(TmplOptionsCmd); err != nil {
+		t.Fatal("App.AddCommand: got error:\n", err)
+	}
+
+	cmd, _ := app.GetByName("deploy")
+	if !strings.HasPrefix(cmd.Usage, "deploy [-count] [-env] [-force] [-v] [-wait]:") {
+		t.Errorf("Command.Usage: got '%s' with ${shortFlags}", cmd.Usage)
+	}
+
+	for _, str := range []string{"environment to deploy to (default \"dev\")", "number of instances (default 1)",
+		"(default 1s)"} {
+		if !strings.Contains(cmd.Usage, str) {
+			t.Errorf("Command.Usage: expected '%s' with ${flags} got:\n%s", str, cmd.Usage)
+		}
+	}
+
+	expect := func(input, res string) {
+		output.Reset()
+		if _, err := app.ExecuteString(input); err != nil {
+			t.Errorf("App.ExecuteString: got error with input '%s':\n%s", input, err)
+		} else if output.String() != res {
+			t.Errorf("App.ExecuteString: got output %q with input '%s' expected %q", output.String(), input, res)
+		}
+	}
+
+	expect("deploy -env prod -force -count 3 -wait 1m -v vvv", "prod true 3 1m0s 3 kept\n")
+	expect("deploy", "dev false 1 1s 0 kept\n")
+
+	if options := TmplOptionsCmd.Options.(*deployOptions); options.Env != "" || options.Count != 0 {
+		t.Error("App.ExecuteString: expected Options to be left untouched")
+	}
+
+	if _, err := app.ExecuteString("deploy -count many"); err == nil {
+		t.Error("App.ExecuteString: expected error with invalid flag value")
+	} else if _, ok := err.(*ErrParseFlags); !ok {
+		t.Error("App.ExecuteString: expected error of type *ErrParseFlags with invalid flag value:\n", err)
+	}
+
+	if _, _, res := app.complete("deploy -"); len(res) != 5 {
+		t.Errorf("App.complete: got %q expected bound flags", res)
+	}
+}
+
+// TestInvalidOptions ensures that commands with invalid Options cannot be
+// added.
+func TestInvalidOptions(t *testing.T) {
+	for _, options := range []interface{}{
+		deployOptions{},
+		&struct {
+			Names []string `flag:"name"`
+		}{},
+		&struct {
+			Count int `flag:"count" default:"many"`
+		}{},
+		&struct {
+			Name string `flag:"-name"`
+		}{},
+		&struct {
+			A string `flag:"name"`
+			B string `flag:"name"`
+		}{},
+	} {
+		app := NewApp("TestInvalidOptions", false)
+		if err := app.AddCommand(Command{Name: "cmd", Options: options, Main: blankMainFunc}); err == nil {
+			t.Errorf("App.AddCommand: expected error with Options %#v", options)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrScript is returned from ExecuteScript if a line of the script returns an
+// error.
+type ErrScript struct {
+	// Name is the name of the script, usually the path of the file.
+	Name string
+
+	// Line is the one-based number of the line which returned the error.
+	Line int
+
+	// Err is the error returned by the line.
+	Err error
+}
+
+// Error implements the error interface for ErrScript.
+func (err *ErrScript) Error() string {
+	return fmt.Sprintf("App.ExecuteScript: %s:%d: %s", err.Name, err.Line, err.Err)
+}
+
+// ExecuteScript reads a script from the reader provided and executes each line
+// in turn as with ExecuteString, without requiring a terminal. Blank lines and
+// lines beginning with '#' are ignored. If the reader has a Name method, as
+// does os.File, its result is used as the name of the script in errors.
+//
+// If a line returns an error it is wrapped in an ErrScript holding the name of
+// the script and the line number. When the App's StopOnError field is true,
+// the script stops immediately and the ErrScript is returned along with the
+// ExitStatus of the line. Otherwise, the ExitStatus and error of the last line
+// are returned, while errors from earlier lines, or from earlier pipelines
+// within a line, are printed to the App's ErrOutput as they occur. A line returning ExitShell or ExitAll always stops
+// the script.
+func (app *App) ExecuteScript(input io.Reader) (ExitStatus, error) {
+	name := "script"
+	if named, ok := input.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+
+	return app.executeScript(context.Background(), input, name, app.Output, app.ErrOutput)
+}
+
+// executeScript does the same as ExecuteScript but takes a context.Context
+// with which each line is executed and the name of the script, and writes the
+// output of each line to output, and its error output and any errors printed
+// as it runs to errOutput, rather than the App's Output and ErrOutput. Once the context.Context is
+// cancelled no further lines are executed.
+func (app *App) executeScript(ctx context.Context, input io.Reader, name string,
+	output, errOutput io.Writer) (ExitStatus, error) {
+	reader := bufio.NewReader(input)
+	status := ExitCmd
+	var scriptErr error
+
+	for number := 1; ; number++ {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return status, &ErrScript{Name: name, Line: number, Err: readErr}
+		}
+
+		// if line is blank or a comment, ignore
+		if trimmed := strings.TrimSpace(line); trimmed != "" && trimmed[0] != '#' {
+			if scriptErr != nil {
+				app.printError(errOutput, scriptErr)
+				scriptErr = nil
+			}
+
+			// errors from pipelines other than the last are reported with the line number
+			report := func(err error) {
+				app.printError(errOutput, &ErrScript{Name: name, Line: number, Err: err})
+			}
+
+			var err error
+			status, err = app.execute(ctx, strings.TrimRight(line, "\r\n"), output, errOutput, report)
+			if err != nil {
+				scriptErr = &ErrScript{Name: name, Line: number, Err: err}
+				if app.StopOnError {
+					return status, scriptErr
+				}
+			}
+
+			if status == ExitShell || status == ExitAll || ctx.Err() != nil {
+				return status, scriptErr
+			}
+		}
+
+		if readErr == io.EOF {
+			return status, scriptErr
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TmplScript is used throughout tests to ensure that scripts are executed as
+// expected. Line 5 calls a non-existent command.
+var TmplScript = `# a comment
+emit one
+
+  emit two | upper
+nothing
+emit three
+`
+
+// TestExecuteScript ensures that each line of a script is executed and that
+// errors are reported with the correct line number.
+func TestExecuteScript(t *testing.T) {
+	WithPipeCommands(t, "TestExecuteScript", func(app *App, output *strings.Builder) {
+		output.Reset()
+		if status, err := app.ExecuteScript(strings.NewReader(TmplScript)); err != nil {
+			t.Error("App.ExecuteScript: got error with error on an earlier line:\n", err)
+		} else if status != ExitCmd {
+			t.Errorf("App.ExecuteScript: got ExitStatus %d expected %d", status, ExitCmd)
+		} else if res := output.String(); res != "one\nTWO\nscript:5: nothing: command not found\nthree\n" {
+			t.Errorf("App.ExecuteScript: got output %q", res)
+		}
+
+		output.Reset()
+		if _, err := app.ExecuteScript(strings.NewReader("emit one\r\nnothing")); err == nil {
+			t.Error("App.ExecuteScript: expected error with error on last line")
+		} else if val, ok := err.(*ErrScript); !ok {
+			t.Error("App.ExecuteScript: expected error of type *ErrScript:\n", err)
+		} else if val.Name != "script" || val.Line != 2 {
+			t.Errorf("App.ExecuteScript: got name '%s' and line %d expected 'script' and 2", val.Name, val.Line)
+		} else if _, ok := val.Err.(*ErrNoCmd); !ok {
+			t.Error("App.ExecuteScript: expected wrapped error of type *ErrNoCmd:\n", val.Err)
+		}
+
+		app.StopOnError = true
+		output.Reset()
+		if _, err := app.ExecuteScript(strings.NewReader(TmplScript)); err == nil {
+			t.Error("App.ExecuteScript: expected error with StopOnError")
+		} else if val, ok := err.(*ErrScript); !ok || val.Line != 5 {
+			t.Error("App.ExecuteScript: expected error of type *ErrScript on line 5:\n", err)
+		} else if res := output.String(); res != "one\nTWO\n" {
+			t.Errorf("App.ExecuteScript: got output %q with StopOnError", res)
+		}
+		app.StopOnError = false
+
+		output.Reset()
+		if status, err := app.ExecuteScript(strings.NewReader("emit one\nexit -shell-only\nemit two\n")); err != nil {
+			t.Error("App.ExecuteScript: got error with exit:\n", err)
+		} else if status != ExitShell {
+			t.Errorf("App.ExecuteScript: got ExitStatus %d with exit expected %d", status, ExitShell)
+		} else if res := output.String(); res != "one\n" {
+			t.Errorf("App.ExecuteScript: got output %q with exit", res)
+		}
+	})
+}
+
+// TestSourceCommand tests the default top-level source command.
+func TestSourceCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSourceCommand")
+	if err != nil {
+		t.Fatal("ioutil.TempDir: got error:\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "script.sh")
+	if err := ioutil.WriteFile(path, []byte(TmplScript+"set sourced=yes\n"), 0666); err != nil {
+		t.Fatal("ioutil.WriteFile: got error:\n", err)
+	}
+
+	WithPipeCommands(t, "TestSourceCommand", func(app *App, output *strings.Builder) {
+		MainInput(t, app, "source with no arguments", "source", "source <file>")
+		MainInput(t, app, "source with non-existent file", "source "+filepath.Join(dir, "missing"),
+			"no such file")
+		MainInput(t, app, "source", "source "+path+" | count", path+":5: nothing: command not found", "3\n")
+
+		if res, ok := app.Variable("sourced"); !ok || res != "yes" {
+			t.Errorf("source: got '%s' for variable set within script expected 'yes'", res)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal("os.Open: got error:\n", err)
+		}
+		defer file.Close()
+
+		app.StopOnError = true
+		if _, err := app.ExecuteScript(file); err == nil {
+			t.Error("App.ExecuteScript: expected error with file")
+		} else if val, ok := err.(*ErrScript); !ok || val.Name != path {
+			t.Errorf("App.ExecuteScript: expected error of type *ErrScript with name '%s':\n%s", path, err)
+		}
+		app.StopOnError = false
+
+		failing := filepath.Join(dir, "failing.sh")
+		if err := ioutil.WriteFile(failing, []byte("emit one\nnothing\n"), 0666); err != nil {
+			t.Fatal("ioutil.WriteFile: got error:\n", err)
+		}
+
+		output.Reset()
+		if status, err := app.ExecuteString("source " + failing + " && emit next"); err != nil {
+			t.Error("App.ExecuteString: got error with failing script:\n", err)
+		} else if code := ExitCode(status, err); code != 1 {
+			t.Errorf("App.ExecuteString: got exit code %d with failing script expected 1", code)
+		} else if res := output.String(); strings.Contains(res, "next") || strings.Contains(res, "source <file>") {
+			t.Errorf("App.ExecuteString: expected '&&' to stop without usage after failing script, got output %q", res)
+		}
+
+		// all error output of the script follows the redirection of source
+		mixed := filepath.Join(dir, "mixed.sh")
+		if err := ioutil.WriteFile(mixed, []byte("fail ; nothing2 ; fail\nnothing3\n"), 0666); err != nil {
+			t.Fatal("ioutil.WriteFile: got error:\n", err)
+		}
+
+		output.Reset()
+		errPath := filepath.Join(dir, "err.txt")
+		if _, err := app.ExecuteString("source " + mixed + " 2> " + errPath); err != nil {
+			t.Error("App.ExecuteString: got error with redirected failing script:\n", err)
+		} else if res, err := ioutil.ReadFile(errPath); err != nil {
+			t.Error("ioutil.ReadFile: got error:\n", err)
+		} else if expected := "fail: always fails\n" + mixed + ":1: nothing2: command not found\n" +
+			"fail: always fails\n" + mixed + ":2: nothing3: command not found\n"; string(res) != expected {
+			t.Errorf("source: got redirected error output %q expected %q", res, expected)
+		} else if output.Len() > 0 {
+			t.Errorf("source: expected no output with redirected error output, got %q", output.String())
+		}
+	})
+}
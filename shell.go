@@ -2,6 +2,8 @@ package shell
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
 )
@@ -25,9 +27,49 @@ const (
 	// ExitAll exits not only the shell loop, but also the entire program. It
 	// is, however, left up to the enclosing program to respect this.
 	ExitAll
+
+	// ExitFailure does the same as ExitCmd but indicates that the command
+	// failed, such that a following '&&' is not run, without printing the
+	// Usage string for the command.
+	ExitFailure
 )
 
-// DefaultCommands defines the following top-level commands: help and exit.
+// ExitCode takes an ExitStatus and an error, as returned from ExecuteString,
+// and returns the corresponding process exit code. Errors take precedence over
+// the ExitStatus:
+//
+//	ErrNoCmd or ErrAmbiguousCmd                    127
+//	ErrParseFlags, ErrInvalidFlag, or ErrParseArgs 2
+//	ErrTimeout                                     124
+//	any other error                                1
+//	ExitUsage                                      2
+//	ExitFailure                                    1
+//	ExitCmd, ExitShell, or ExitAll                 0
+func ExitCode(status ExitStatus, err error) int {
+	switch err.(type) {
+	case nil:
+	case *ErrNoCmd, *ErrAmbiguousCmd:
+		return 127
+	case *ErrParseFlags, *ErrInvalidFlag, *ErrParseArgs:
+		return 2
+	case *ErrTimeout:
+		return 124
+	default:
+		return 1
+	}
+
+	switch status {
+	case ExitUsage:
+		return 2
+	case ExitFailure:
+		return 1
+	}
+
+	return 0
+}
+
+// DefaultCommands defines the following top-level commands: help, exit, set,
+// unset, env, alias, unalias, source, history, jobs, fg, wait, and kill.
 var DefaultCommands = []*Command{
 	{
 		Name:     "exit",
@@ -53,7 +95,7 @@ var DefaultCommands = []*Command{
 	{
 		Name:     "help",
 		Synopsis: "list existing commands and their synopsis",
-		Usage:    "${name} [<command name>]",
+		Usage:    "${name} [<command name> [<sub-command>...]]",
 		Main: func(ctx *Context) ExitStatus {
 			switch ctx.FlagSet().NArg() {
 			case 0:
@@ -66,24 +108,387 @@ var DefaultCommands = []*Command{
 					list = append(list, fmt.Sprintf("\t%s\t\t%s\n", command.Name, command.Synopsis))
 				}
 				sort.Strings(list)
-				ctx.App().Printf("Available commands:\n%s\n\nFor more information, type `help <command name>`.",
-					strings.Join(list, ""))
-			case 1:
+				ctx.Printf("Available commands:\n%s\n", strings.Join(list, ""))
+
+				// if any aliases exist, list them and their values
+				if aliases := ctx.App().Aliases(); len(aliases) > 0 {
+					list = make([]string, 0, len(aliases))
+					for name, value := range aliases {
+						list = append(list, fmt.Sprintf("\t%s\t\t%s\n", name, quote(value)))
+					}
+					sort.Strings(list)
+					ctx.Printf("Aliases:\n%s\n", strings.Join(list, ""))
+				}
+
+				ctx.Print("\nFor more information, type `help <command name>`.")
+			default:
+				if value, ok := ctx.App().Alias(ctx.FlagSet().Arg(0)); ok && ctx.FlagSet().NArg() == 1 {
+					ctx.Printf("%s: alias for %s\n", ctx.FlagSet().Arg(0), quote(value))
+					return ExitCmd
+				}
+
 				requested, err := ctx.App().GetByName(ctx.FlagSet().Arg(0))
-				if err != nil {
-					ctx.App().Printf("%s: command not found\n", ctx.FlagSet().Arg(0))
+				if ambiguous, ok := err.(*ErrAmbiguousCmd); ok {
+					fmt.Fprintf(ctx.ErrOutput(), "%s: ambiguous command, could be: %s\n", ambiguous.Name,
+						strings.Join(ambiguous.Candidates, ", "))
+					return ExitUsage
+				} else if err != nil {
+					fmt.Fprintf(ctx.ErrOutput(), "%s: command not found\n", ctx.FlagSet().Arg(0))
+					return ExitUsage
+				}
+
+				// walk any sub-commands provided, as in help <command> <sub-command>
+				for _, name := range ctx.FlagSet().Args()[1:] {
+					subCmd, err := requested.GetSubCommand(name)
+					if err != nil {
+						printSubCommandError(ctx.ErrOutput(), requested, name, err)
+						return ExitUsage
+					}
+
+					requested = subCmd
+				}
+
+				ctx.Println(requested.help())
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "set",
+		Synopsis: "set the value of shell variables",
+		Usage: `${name} <name>=<value> [<name>=<value>...]:
+
+Set the value of one or more shell variables, which may then be referenced
+within input as $<name> or ${<name>}. Names may contain only letters, digits,
+and underscores, and may not begin with a digit.`,
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() == 0 {
+				return ExitUsage
+			}
+
+			// ensure all assignments are valid before setting any
+			for _, arg := range ctx.FlagSet().Args() {
+				index := strings.IndexByte(arg, '=')
+				if index == -1 {
+					return ExitUsage
+				}
+
+				if !isValidName(arg[:index]) {
+					fmt.Fprintf(ctx.ErrOutput(), "%s: invalid variable name\n", arg[:index])
+					return ExitUsage
+				}
+			}
+
+			for _, arg := range ctx.FlagSet().Args() {
+				index := strings.IndexByte(arg, '=')
+				ctx.SetVariable(arg[:index], arg[index+1:])
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "unset",
+		Synopsis: "remove shell variables",
+		Usage:    "${name} <name> [<name>...]",
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() == 0 {
+				return ExitUsage
+			}
+
+			for _, name := range ctx.FlagSet().Args() {
+				ctx.UnsetVariable(name)
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "env",
+		Synopsis: "list all shell variables and their values",
+		Usage:    "${name}",
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() > 0 {
+				return ExitUsage
+			}
+
+			variables := ctx.App().Variables()
+			list := make([]string, 0, len(variables))
+			for name, value := range variables {
+				list = append(list, fmt.Sprintf("%s=%s\n", name, value))
+			}
+			sort.Strings(list)
+			ctx.Print(strings.Join(list, ""))
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "alias",
+		Synopsis: "define or list aliases",
+		Usage: `${name} [<name>[=<value>]...]:
+
+With no arguments, print a list of all aliases. With an argument in the form
+<name>=<value>, define an alias which replaces <name> with <value> when it is
+used as the name of a command. With an argument in the form <name>, print the
+definition of that alias.`,
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() == 0 {
+				aliases := ctx.App().Aliases()
+				list := make([]string, 0, len(aliases))
+				for name, value := range aliases {
+					list = append(list, fmt.Sprintf("%s=%s\n", name, quote(value)))
+				}
+				sort.Strings(list)
+				ctx.Print(strings.Join(list, ""))
+
+				return ExitCmd
+			}
+
+			status := ExitCmd
+			for _, arg := range ctx.FlagSet().Args() {
+				index := strings.IndexByte(arg, '=')
+				if index == -1 {
+					if value, ok := ctx.App().Alias(arg); ok {
+						ctx.Printf("%s=%s\n", arg, quote(value))
+					} else {
+						fmt.Fprintf(ctx.ErrOutput(), "%s: alias not found\n", arg)
+						status = ExitUsage
+					}
+
+					continue
+				}
+
+				if err := ctx.App().AddAlias(arg[:index], arg[index+1:]); err != nil {
+					fmt.Fprintln(ctx.ErrOutput(), err)
+					status = ExitUsage
+				}
+			}
+
+			return status
+		},
+	},
+	{
+		Name:     "unalias",
+		Synopsis: "remove aliases",
+		Usage:    "${name} <name> [<name>...]",
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() == 0 {
+				return ExitUsage
+			}
+
+			for _, name := range ctx.FlagSet().Args() {
+				if err := ctx.App().RemoveAlias(name); err != nil {
+					fmt.Fprintf(ctx.ErrOutput(), "%s: alias not found\n", name)
+					return ExitUsage
+				}
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "source",
+		Synopsis: "run commands from a file",
+		Usage: `${name} <file>:
+
+Run each line of <file> as a command within the current shell. Blank lines
+and lines beginning with '#' are ignored. Fails if the last line fails, or if
+any line fails while StopOnError is set.`,
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() != 1 {
+				return ExitUsage
+			}
+
+			file, err := os.Open(ctx.FlagSet().Arg(0))
+			if err != nil {
+				fmt.Fprintf(ctx.ErrOutput(), "%s: %s\n", ctx.FlagSet().Arg(0), err)
+				return ExitUsage
+			}
+			defer file.Close()
+
+			status, err := ctx.App().executeScript(ctx.Context(), file, ctx.FlagSet().Arg(0), ctx.Output(),
+				ctx.ErrOutput())
+			if err != nil {
+				ctx.App().printError(ctx.ErrOutput(), err)
+			}
+
+			// propagate statuses which exit the shell, and failure of the script
+			if status == ExitShell || status == ExitAll {
+				return status
+			} else if err != nil || status == ExitUsage || status == ExitFailure {
+				return ExitFailure
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "history",
+		Synopsis: "list, search, or clear the command history",
+		Usage: `${name} ${shortFlags} [<text>]:
+
+With no arguments, list all entries in the history, each preceded by the
+number with which it may be referred to as !<number>. With <text>, list only
+those entries containing it.
+
+${flags}`,
+		SetFlags: func(ctx *Context) {
+			ctx.Set("flagClear", ctx.FlagSet().Bool("clear", false, "remove all entries from the history"))
+		},
+		Main: func(ctx *Context) ExitStatus {
+			if *ctx.ShouldGet("flagClear").(*bool) {
+				if ctx.FlagSet().NArg() > 0 {
+					return ExitUsage
+				}
+
+				if err := ctx.App().ClearHistory(); err != nil {
+					fmt.Fprintln(ctx.ErrOutput(), err)
+				}
+
+				return ExitCmd
+			}
+
+			if ctx.FlagSet().NArg() > 1 {
+				return ExitUsage
+			}
+
+			for key, entry := range ctx.App().History() {
+				if ctx.FlagSet().NArg() == 0 || strings.Contains(entry, ctx.FlagSet().Arg(0)) {
+					ctx.Printf("%5d  %s\n", key+1, entry)
+				}
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "jobs",
+		Synopsis: "list background jobs",
+		Usage: `${name}:
+
+List each job started by ending a command with '&', along with whether it
+is still running.`,
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() > 0 {
+				return ExitUsage
+			}
+
+			for _, job := range ctx.App().Jobs() {
+				ctx.Printf("[%d] %-8s %s\n", job.ID, job.state(), job.Input)
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "fg",
+		Synopsis: "bring a background job to the foreground",
+		Usage: `${name} [<job>]:
+
+Print the output of <job>, or of the most recent job if none is provided, and
+wait for it to finish while printing any further output. Jobs are referred to
+as <id> or %<id>. The job is killed if the wait is interrupted.`,
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() > 1 {
+				return ExitUsage
+			}
+
+			var job *Job
+			if ctx.FlagSet().NArg() == 1 {
+				var ok bool
+				if job, ok = ctx.App().findJob(ctx.FlagSet().Arg(0)); !ok {
+					fmt.Fprintf(ctx.ErrOutput(), "%s: no such job\n", ctx.FlagSet().Arg(0))
 					return ExitCmd
 				}
+			} else if jobs := ctx.App().Jobs(); len(jobs) > 0 {
+				job = jobs[len(jobs)-1]
+			} else {
+				fmt.Fprintln(ctx.ErrOutput(), "no current job")
+				return ExitCmd
+			}
+
+			ctx.Println(job.Input)
+			job.output.attach(ctx.Output())
+
+			select {
+			case <-job.done:
+			case <-ctx.Context().Done():
+				job.Kill()
+			}
+
+			status, err := job.Wait()
+			ctx.App().removeJob(job)
+			if err != nil {
+				ctx.App().printError(ctx.ErrOutput(), err)
+			}
+
+			// only propagate statuses which exit the shell
+			if status == ExitShell || status == ExitAll {
+				return status
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "wait",
+		Synopsis: "wait for background jobs to finish",
+		Usage: `${name} [<job>...]:
+
+Wait for each <job>, or for every job if none are provided, to finish and
+print its output and state. Jobs are referred to as <id> or %<id>.`,
+		Main: func(ctx *Context) ExitStatus {
+			jobs := ctx.App().Jobs()
+			if ctx.FlagSet().NArg() > 0 {
+				jobs = make([]*Job, 0, ctx.FlagSet().NArg())
+				for _, arg := range ctx.FlagSet().Args() {
+					job, ok := ctx.App().findJob(arg)
+					if !ok {
+						fmt.Fprintf(ctx.ErrOutput(), "%s: no such job\n", arg)
+						return ExitCmd
+					}
+
+					jobs = append(jobs, job)
+				}
+			}
 
-				if requested.Usage == "" {
-					ctx.App().Printf("%s\t\t%s\n", requested.Name, requested.Synopsis)
-				} else {
-					ctx.App().Printf("%s\n", requested.Usage)
+			for _, job := range jobs {
+				select {
+				case <-job.done:
+				case <-ctx.Context().Done():
+					return ExitCmd
 				}
-			default: // if more than 1 argument was provided, print usage
+
+				ctx.App().reportJob(job, ctx.Output(), ctx.ErrOutput())
+			}
+
+			return ExitCmd
+		},
+	},
+	{
+		Name:     "kill",
+		Synopsis: "stop background jobs",
+		Usage: `${name} <job>...:
+
+Cancel the commands run by each <job>, such that no further commands are run
+once the current one returns. Jobs are referred to as <id> or %<id>.`,
+		Main: func(ctx *Context) ExitStatus {
+			if ctx.FlagSet().NArg() == 0 {
 				return ExitUsage
 			}
 
+			for _, arg := range ctx.FlagSet().Args() {
+				job, ok := ctx.App().findJob(arg)
+				if !ok {
+					fmt.Fprintf(ctx.ErrOutput(), "%s: no such job\n", arg)
+					continue
+				}
+
+				job.Kill()
+			}
+
 			return ExitCmd
 		},
 	},
@@ -104,7 +509,7 @@ Print a list of all sub-commands.`,
 			}
 
 			for _, subCmd := range ctx.Parent().SubCommands {
-				ctx.App().Println(subCmd.Name)
+				ctx.Println(subCmd.Name)
 			}
 
 			return ExitCmd
@@ -117,7 +522,8 @@ Print a list of all sub-commands.`,
 
 With an argument, print all flags of <sub-command>. Else, print a
 description of all known top-level flags. (The basic help information only
-discusses the most generally important top-level flags.)`,
+discusses the most generally important top-level flags.) Flags inherited from
+parent commands and flags accepted by every command are listed separately.`,
 		Main: func(ctx *Context) ExitStatus {
 			flags := ctx.FlagSet()
 
@@ -125,31 +531,37 @@ discusses the most generally important top-level flags.)`,
 				return ExitUsage
 			}
 
-			var reqCmd *Command
-			if flags.NArg() == 0 {
-				reqCmd = ctx.Parent()
-			} else {
-				for _, cmd := range ctx.Parent().SubCommands {
-					if flags.Arg(0) == cmd.Name {
-						reqCmd = &cmd
-						break
-					}
-				}
-
+			reqCmd := ctx.Parent()
+			if flags.NArg() == 1 {
+				var err error
 				// if no command was found, print error
-				if reqCmd == nil {
-					ctx.App().Printf("%s %s: sub-command not found", ctx.Parent().Name, flags.Arg(0))
-					return ExitCmd
+				if reqCmd, err = ctx.Parent().GetSubCommand(flags.Arg(0)); err != nil {
+					printSubCommandError(ctx.ErrOutput(), ctx.Parent(), flags.Arg(0), err)
+					return ExitUsage
 				}
 			}
 
 			reqCtx := reqCmd.NewContext()
-			// if setFlags function is provided, call it
-			if reqCmd.SetFlags != nil {
-				reqCmd.SetFlags(reqCtx)
+			if err := reqCmd.setLocalFlags(reqCtx); err != nil {
+				fmt.Fprintln(ctx.ErrOutput(), err)
+				return ExitCmd
 			}
 
-			reqCtx.FlagSet().PrintDefaults()
+			ctx.Print(reqCmd.flagDefaults(reqCtx))
+
+			parentCtx := reqCmd.NewContext()
+			reqCmd.setParentFlags(parentCtx)
+			if defaults := reqCmd.flagDefaults(parentCtx); defaults != "" {
+				ctx.Printf("\nInherited flags:\n%s", defaults)
+			}
+
+			if ctx.App().SetFlags != nil {
+				appCtx := reqCmd.NewContext()
+				ctx.App().SetFlags(appCtx)
+				if defaults := reqCmd.flagDefaults(appCtx); defaults != "" {
+					ctx.Printf("\nGlobal flags:\n%s", defaults)
+				}
+			}
 
 			return ExitCmd
 		},
@@ -177,28 +589,17 @@ description of each.`,
 				}
 				sort.Strings(list)
 
-				ctx.App().Printf("Usage: %s <sub-command> <sub-command args>\n\n"+
-					"Sub-commands:\n%s", parent.Name, strings.Join(list, ""))
+				ctx.Printf("Usage: %s <sub-command> <sub-command args>\n\n"+
+					"Sub-commands:\n%s", parent.FullName(), strings.Join(list, ""))
 			case 1:
-				var reqCmd *Command
-				for _, cmd := range parent.SubCommands {
-					if ctx.FlagSet().Arg(0) == cmd.Name {
-						reqCmd = &cmd
-						break
-					}
-				}
-
+				reqCmd, err := parent.GetSubCommand(ctx.FlagSet().Arg(0))
 				// if no command was found, print error
-				if reqCmd == nil {
-					ctx.App().Printf("%s %s: sub-command not found", parent.Name, ctx.FlagSet().Arg(0))
-					return ExitCmd
+				if err != nil {
+					printSubCommandError(ctx.ErrOutput(), parent, ctx.FlagSet().Arg(0), err)
+					return ExitUsage
 				}
 
-				if reqCmd.Usage == "" {
-					ctx.App().Printf("%s\t\t%s\n", reqCmd.Name, reqCmd.Synopsis)
-				} else {
-					ctx.App().Printf("%s\n", reqCmd.Usage)
-				}
+				ctx.Println(reqCmd.help())
 			default:
 				return ExitUsage
 			}
@@ -207,3 +608,17 @@ description of each.`,
 		},
 	},
 }
+
+// printSubCommandError takes the error returned by GetSubCommand when looking
+// up the named sub-command of cmd and writes it to errOutput, listing the
+// candidates if the name is an ambiguous prefix, as printed by the default
+// help commands.
+func printSubCommandError(errOutput io.Writer, cmd *Command, name string, err error) {
+	if ambiguous, ok := err.(*ErrAmbiguousCmd); ok {
+		fmt.Fprintf(errOutput, "%s %s: ambiguous sub-command, could be: %s\n", cmd.FullName(), ambiguous.Name,
+			strings.Join(ambiguous.Candidates, ", "))
+		return
+	}
+
+	fmt.Fprintf(errOutput, "%s %s: sub-command not found\n", cmd.FullName(), name)
+}
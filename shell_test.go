@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -37,7 +38,52 @@ func TestHelpCommand(t *testing.T) {
 
 	MainInput(t, app, "help for 'exit' command", "help exit", "exit", "exit [-shell-only]")
 	MainInput(t, app, "help for non-existent 'nothing' command", "help nothing", "command not found")
-	MainInput(t, app, "help with too many arguments", "help exit test", "help [<command name>]")
+	MainInput(t, app, "help with non-existent sub-command", "help exit test", "exit test: sub-command not found")
+
+	WithSubCommands(t, "TestHelpCommand", func(app *App) {
+		MainInput(t, app, "help for sub-command", "help test secondary", "test secondary [-second]")
+		MainInput(t, app, "help for sub-command without Usage string", "help test no-usage",
+			"a useless command with no usage")
+
+		// errors are written to the error output and the command fails
+		output, errOutput := &strings.Builder{}, &strings.Builder{}
+		app.Output, app.ErrOutput = output, errOutput
+		app.AllowAbbreviations = true
+
+		expect := func(input, message string) {
+			output.Reset()
+			errOutput.Reset()
+			if status, err := app.ExecuteString(input); err != nil || status != ExitUsage {
+				t.Errorf("App.ExecuteString: got ExitStatus %d and error %v with input `%s` expected ExitUsage",
+					status, err, input)
+			} else if !strings.HasPrefix(errOutput.String(), message) || strings.Contains(output.String(), message) {
+				t.Errorf("App.ExecuteString: expected only error output to contain '%s' with input `%s`, got "+
+					"output %q and error output %q", message, input, output.String(), errOutput.String())
+			}
+		}
+
+		if err := app.AddCommand(Command{
+			Name: "service",
+			SetFlags: func(ctx *Context) {
+				ctx.FlagSet().Bool("force", false, "skip checks")
+			},
+			Main: blankMainFunc,
+			SubCommands: []Command{
+				{Name: "start", Main: blankMainFunc},
+				{Name: "stop", Main: blankMainFunc},
+			},
+		}); err != nil {
+			t.Fatal("App.AddCommand: got error:\n", err)
+		}
+
+		expect("help nothing", "nothing: command not found\n")
+		expect("help test missing", "test missing: sub-command not found\n")
+		expect("help service st", "service st: ambiguous sub-command, could be: start, stop\n")
+		expect("service help st", "service st: ambiguous sub-command, could be: start, stop\n")
+		expect("service flags st", "service st: ambiguous sub-command, could be: start, stop\n")
+		expect("test help missing", "test missing: sub-command not found\n")
+		expect("test flags missing", "test missing: sub-command not found\n")
+	})
 }
 
 // TestCommandsSubCommand tests the default second-level commands command.
@@ -69,3 +115,26 @@ func TestHelpSubCommand(t *testing.T) {
 		MainInput(t, app, "help for non-existant 'nothing' sub-command", "test help nothing", "test nothing", "not found")
 	})
 }
+
+// TestVariableCommands tests the default top-level set, unset, and env
+// commands.
+func TestVariableCommands(t *testing.T) {
+	app := NewApp("TestVariableCommands", true)
+
+	MainInput(t, app, "set with no arguments", "set", "set <name>=<value>")
+	MainInput(t, app, "set without '='", "set host", "set <name>=<value>")
+	MainInput(t, app, "set with invalid name", "set 1host=db01", "1host: invalid variable name")
+	MainInput(t, app, "set and env", "set host=db01 'msg=hello world'\nenv", "host=db01\nmsg=hello world\n")
+	MainInput(t, app, "set and expansion", "set cmd=env; $cmd", "host=db01")
+	MainInput(t, app, "unset with no arguments", "unset", "unset <name>")
+	MainInput(t, app, "env with arguments", "env host", "env")
+
+	if _, ok := app.Variable("msg"); !ok {
+		t.Fatal("App.Variable: expected variable 'msg' set by 'set' command to exist")
+	}
+
+	MainInput(t, app, "unset", "unset msg host")
+	if variables := app.Variables(); len(variables) != 1 || variables["cmd"] != "env" {
+		t.Errorf("App.Variables: got %v after 'unset' expected only 'cmd'", variables)
+	}
+}
@@ -0,0 +1,158 @@
+package shell
+
+import (
+	"flag"
+	"sort"
+	"strings"
+)
+
+// undefinedFlag is the beginning of the error message returned by
+// flag.FlagSet.Parse or parseGNU when the input contains a flag which is not
+// defined, followed by the flag with its leading '-' or '--'.
+const undefinedFlag = "flag provided but not defined: "
+
+// distance takes two strings and returns the number of single-rune
+// insertions, deletions, substitutions, and transpositions of adjacent runes
+// required to turn one into the other.
+func distance(a, b string) int {
+	source, target := []rune(a), []rune(b)
+
+	// rows holds the last three rows of the distance matrix
+	rows := [3][]int{}
+	for key := range rows {
+		rows[key] = make([]int, len(target)+1)
+	}
+
+	for j := range rows[2] {
+		rows[2][j] = j
+	}
+
+	for i := 1; i <= len(source); i++ {
+		rows[0], rows[1], rows[2] = rows[1], rows[2], rows[0]
+		rows[2][0] = i
+
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+
+			rows[2][j] = minimum(rows[1][j]+1, rows[2][j-1]+1, rows[1][j-1]+cost)
+			if i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] {
+				rows[2][j] = minimum(rows[2][j], rows[0][j-2]+1)
+			}
+		}
+	}
+
+	return rows[2][len(target)]
+}
+
+// minimum returns the smallest of the integers provided.
+func minimum(first int, rest ...int) int {
+	for _, item := range rest {
+		if item < first {
+			first = item
+		}
+	}
+
+	return first
+}
+
+// suggest takes a name which could not be found and a list of candidates and
+// returns those candidates which the name is likely a misspelling of, ordered
+// from closest to furthest. A candidate is close enough if it is within one
+// edit for every three runes of the name, so no suggestions are made for names
+// shorter than three runes.
+func suggest(name string, candidates []string) []string {
+	maxDistance := len([]rune(name)) / 3
+	distances := make(map[string]int)
+	suggestions := make([]string, 0)
+
+	for _, item := range candidates {
+		if _, ok := distances[item]; ok || item == name {
+			continue
+		}
+
+		if res := distance(name, item); res <= maxDistance {
+			distances[item] = res
+			suggestions = append(suggestions, item)
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+
+		return suggestions[i] < suggestions[j]
+	})
+
+	return suggestions
+}
+
+// suggestCommands takes the name of a command which could not be found and
+// returns the names and aliases of commands, as well as the names of App
+// aliases, which it is likely a misspelling of.
+func (app *App) suggestCommands(name string) []string {
+	candidates := make([]string, 0)
+	for _, cmd := range app.Commands {
+		candidates = append(candidates, cmd.names()...)
+	}
+
+	for alias := range app.Aliases() {
+		candidates = append(candidates, alias)
+	}
+
+	return suggest(name, candidates)
+}
+
+// suggestSubCommands takes the name of a sub-command which could not be found
+// and returns the names and aliases of the sub-commands of the command which
+// it is likely a misspelling of.
+func (cmd *Command) suggestSubCommands(name string) []string {
+	candidates := make([]string, 0)
+	for _, subCmd := range cmd.SubCommands {
+		candidates = append(candidates, subCmd.names()...)
+	}
+
+	return suggest(name, candidates)
+}
+
+// checkSubCommandTypo takes the positional arguments of a command which
+// failed and, if the first is not the name of a sub-command but closely
+// resembles one, returns an ErrNoCmd holding suggestions for it, as it is
+// likely a misspelling rather than an argument of the command.
+func (cmd *Command) checkSubCommandTypo(args []string) error {
+	if len(cmd.SubCommands) == 0 || len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil
+	}
+
+	if suggestions := cmd.suggestSubCommands(args[0]); len(suggestions) > 0 {
+		return &ErrNoCmd{Name: cmd.FullName() + " " + args[0], Suggestions: suggestions}
+	}
+
+	return nil
+}
+
+// suggestFlags takes a FlagSet, the prefix with which its flags are provided
+// as returned by flagPrefix, and the error returned while parsing it and, if
+// the error is caused by an undefined flag, returns the flags which it is
+// likely a misspelling of, each preceded by the prefix.
+func suggestFlags(flags *flag.FlagSet, prefix string, err error) []string {
+	if !strings.HasPrefix(err.Error(), undefinedFlag) {
+		return nil
+	}
+
+	candidates := make([]string, 0)
+	flags.VisitAll(func(item *flag.Flag) {
+		candidates = append(candidates, item.Name)
+	})
+
+	name := strings.TrimLeft(strings.TrimPrefix(err.Error(), undefinedFlag), "-")
+	suggestions := suggest(name, candidates)
+	for key := range suggestions {
+		suggestions[key] = prefix + suggestions[key]
+	}
+
+	return suggestions
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDistance ensures that the edit distance between strings is calculated
+// correctly, counting transpositions as a single edit.
+func TestDistance(t *testing.T) {
+	expect := func(a, b string, result int) {
+		if res := distance(a, b); res != result {
+			t.Errorf("distance: got %d between '%s' and '%s' expected %d", res, a, b, result)
+		}
+	}
+
+	expect("", "", 0)
+	expect("", "abc", 3)
+	expect("abc", "", 3)
+	expect("drain", "drain", 0)
+	expect("drian", "drain", 1)
+	expect("drai", "drain", 1)
+	expect("dxain", "drain", 1)
+	expect("kitten", "sitting", 3)
+	expect("wörds", "words", 1)
+}
+
+// TestSuggest ensures that only close candidates are suggested and that they
+// are ordered from closest to furthest.
+func TestSuggest(t *testing.T) {
+	expect := func(name string, candidates []string, result ...string) {
+		if res := suggest(name, candidates); (len(res) > 0 || len(result) > 0) && !reflect.DeepEqual(res, result) {
+			t.Errorf("suggest: got %q with '%s' expected %q", res, name, result)
+		}
+	}
+
+	candidates := []string{"help", "exit", "interfaces", "interrupts", "set", "unset"}
+
+	expect("hlep", candidates, "help")
+	expect("interfcaes", candidates, "interfaces")
+	expect("interupts", candidates, "interrupts")
+	expect("esxit", candidates, "exit")
+	expect("tset", []string{"unset", "test", "set"}, "set", "test")
+	expect("st", candidates)
+	expect("nothing", candidates)
+	expect("help", []string{"help", "helm", "helm"}, "helm")
+}
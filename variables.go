@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Variable takes a name and returns the value of the App variable by that name
+// and whether it exists.
+func (app *App) Variable(name string) (string, bool) {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	value, ok := app.variables[name]
+	return value, ok
+}
+
+// SetVariable takes a name and a value and sets the App variable by that name.
+// An error is returned if the name is invalid. Names must not be empty, may
+// contain only letters, digits, and underscores, and may not begin with a
+// digit.
+func (app *App) SetVariable(name, value string) error {
+	if !isValidName(name) {
+		return fmt.Errorf("App.SetVariable: invalid variable name '%s'", name)
+	}
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if app.variables == nil {
+		app.variables = make(map[string]string)
+	}
+
+	app.variables[name] = value
+	return nil
+}
+
+// UnsetVariable takes a name and removes the App variable by that name. No
+// error is returned regardless of whether a deletion actually occurs.
+func (app *App) UnsetVariable(name string) {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	delete(app.variables, name)
+}
+
+// Variables returns a copy of all App variables.
+func (app *App) Variables() map[string]string {
+	app.mutex.RLock()
+	defer app.mutex.RUnlock()
+
+	variables := make(map[string]string, len(app.variables))
+	for name, value := range app.variables {
+		variables[name] = value
+	}
+
+	return variables
+}
+
+// ImportEnv sets an App variable for each variable in the environment of the
+// process, overwriting any which already exist. Environment variables with
+// names that are not valid App variable names are ignored.
+func (app *App) ImportEnv() {
+	for _, item := range os.Environ() {
+		if index := strings.IndexByte(item, '='); index > 0 {
+			app.SetVariable(item[:index], item[index+1:])
+		}
+	}
+}
+
+// lookupVariable returns the value of the App variable by the name provided or
+// an empty string if it does not exist. It is used to expand variables within
+// user input.
+func (app *App) lookupVariable(name string) string {
+	value, _ := app.Variable(name)
+	return value
+}
@@ -0,0 +1,119 @@
+package shell
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestVariables ensures that App variables may be set, fetched, and removed
+// and that invalid names are rejected.
+func TestVariables(t *testing.T) {
+	app := &App{}
+
+	if _, ok := app.Variable("host"); ok {
+		t.Error("App.Variable: expected non-existent variable to not exist")
+	}
+
+	if err := app.SetVariable("host", "db01"); err != nil {
+		t.Error("App.SetVariable: got error:\n", err)
+	} else if res, ok := app.Variable("host"); !ok || res != "db01" {
+		t.Errorf("App.Variable: got '%s' expected 'db01'", res)
+	}
+
+	for _, name := range []string{"", "1host", "host-name", "host name"} {
+		if err := app.SetVariable(name, "value"); err == nil {
+			t.Errorf("App.SetVariable: expected error with invalid name '%s'", name)
+		} else if !strings.Contains(err.Error(), "invalid variable name") {
+			t.Errorf("App.SetVariable: got unexpected error message with invalid name '%s':\n%s", name, err)
+		}
+	}
+
+	variables := app.Variables()
+	variables["other"] = "value"
+	if len(app.Variables()) != 1 {
+		t.Error("App.Variables: expected a copy of variables")
+	}
+
+	app.UnsetVariable("host")
+	if _, ok := app.Variable("host"); ok {
+		t.Error("App.UnsetVariable: expected variable to not exist after unset")
+	}
+
+	if err := os.Setenv("SHELL_TEST_IMPORT", "imported"); err != nil {
+		t.Fatal("os.Setenv: got error:\n", err)
+	}
+	defer os.Unsetenv("SHELL_TEST_IMPORT")
+
+	app.ImportEnv()
+	if res, ok := app.Variable("SHELL_TEST_IMPORT"); !ok || res != "imported" {
+		t.Errorf("App.ImportEnv: got '%s' for variable 'SHELL_TEST_IMPORT' expected 'imported'", res)
+	}
+}
+
+// TestVariableExpansion ensures that variables are expanded within input
+// before command matching and that commands may access variables through the
+// Context.
+func TestVariableExpansion(t *testing.T) {
+	WithPipeCommands(t, "TestVariableExpansion", func(app *App, output *strings.Builder) {
+		app.SetVariable("host", "db01")
+		app.SetVariable("words", "  a  b ")
+		app.SetVariable("cmd", "emit")
+
+		expect := func(input string, result string) {
+			output.Reset()
+			if _, err := app.ExecuteString(input); err != nil {
+				t.Errorf("App.ExecuteString: got error with input `%s`:\n%s", input, err)
+			} else if output.String() != result {
+				t.Errorf("App.ExecuteString: got output %q with input `%s` expected %q", output.String(), input,
+					result)
+			}
+		}
+
+		expect("emit $host", "db01\n")
+		expect("emit ${host}s x${host}y", "db01s\nxdb01y\n")
+		expect(`emit "$host" '$host' \$host "\$host"`, "db01\n$host\n$host\n$host\n")
+		expect("emit $words", "a\nb\n")
+		expect(`emit "$words"`, "  a  b \n")
+		expect("emit x${words}y", "x\na\nb\ny\n")
+		expect("emit $missing a", "a\n")
+		expect(`emit "$missing" a`, "\na\n")
+		expect("emit $ a$ $1", "$\na$\n$1\n")
+		expect("$cmd $host | upper", "DB01\n")
+		expect("set host=db02; emit $host", "db02\n")
+
+		if _, err := app.ExecuteString("emit ${host"); err == nil {
+			t.Error("App.ExecuteString: expected error with unterminated variable reference")
+		} else if val, ok := err.(*ErrParseInput); !ok || val.Position != 5 {
+			t.Error("App.ExecuteString: expected error of type *ErrParseInput at position 5:\n", err)
+		}
+
+		if _, err := app.ExecuteString("emit ${1x}"); err == nil {
+			t.Error("App.ExecuteString: expected error with invalid variable name")
+		}
+
+		if _, err := app.ExecuteString("emit a > $words"); err == nil {
+			t.Error("App.ExecuteString: expected error with ambiguous redirect")
+		} else if _, ok := err.(*ErrRedirect); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrRedirect with ambiguous redirect:\n", err)
+		}
+
+		if _, err := app.ExecuteString("$missing"); err == nil {
+			t.Error("App.ExecuteString: expected error with command expanding to nothing")
+		} else if _, ok := err.(*ErrParseInput); !ok {
+			t.Error("App.ExecuteString: expected error of type *ErrParseInput with empty command:\n", err)
+		}
+
+		ctx := NewContext(app, nil, nil, nil)
+		if err := ctx.SetVariable("fromCtx", "value"); err != nil {
+			t.Error("Context.SetVariable: got error:\n", err)
+		} else if res, ok := ctx.Variable("fromCtx"); !ok || res != "value" {
+			t.Errorf("Context.Variable: got '%s' expected 'value'", res)
+		}
+
+		ctx.UnsetVariable("fromCtx")
+		if _, ok := app.Variable("fromCtx"); ok {
+			t.Error("Context.UnsetVariable: expected variable to not exist after unset")
+		}
+	})
+}